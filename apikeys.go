@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// APIKey es una clave de acceso guardada como hash SHA-256, las listas
+// vacías permiten cualquier valor y Expires vacío indica que no vence
+type APIKey struct {
+	Label      string   `json:"label"`
+	ID         string   `json:"id"` // identificador aleatorio para X-Key-Id, sin id la clave no puede firmar
+	Hash       string   `json:"hash"`
+	DbTypes    []string `json:"dbtypes"`
+	Dbnames    []string `json:"dbnames"`
+	Querytypes []string `json:"querytypes"`
+	Expires    string   `json:"expires"`
+
+	// MultiStatements permite enviar varias sentencias en un mismo dbquery
+	MultiStatements bool `json:"multistatements"`
+
+	// Queries limita las consultas guardadas permitidas y StoredOnly
+	// impide enviar dbquery, solo se aceptan consultas guardadas
+	Queries    []string `json:"queries"`
+	StoredOnly bool     `json:"storedonly"`
+
+	// Admin permite las operaciones de /admin (restaurar respaldos) sobre
+	// los dbtypes y dbnames de la clave
+	Admin bool `json:"admin"`
+
+	// límites propios de la clave, 0 usa los del servidor (ver Limits)
+	MaxRows          int   `json:"maxrows"`
+	MaxResponseBytes int64 `json:"maxresponsebytes"`
+	QueryTimeout     int   `json:"querytimeout"` // segundos
+}
+
+type KeyStore struct {
+	keys []APIKey
+}
+
+const keyStoreFile = "apikeys.json"
+
+// apikey de los dbsettings.json creados por versiones anteriores, no se acepta
+const defaultApiKey = "apikey"
+
+// LoadKeyStore lee las claves de apikeys.json. Si el archivo no existe se usa
+// la apikey de dbsettings.json con acceso a todas las bases pero sin
+// operaciones de administración; con el valor por defecto no se inicia
+func LoadKeyStore(fileName string, conf map[string]string) (*KeyStore, error) {
+	dat, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		if conf["apikey"] == defaultApiKey {
+			return nil, fmt.Errorf("la apikey de dbsettings.json tiene el valor por defecto '%s': cámbiela o cree %s con 'micro_db_server newkey <etiqueta>'", defaultApiKey, fileName)
+		}
+		store := &KeyStore{}
+		if conf["apikey"] != "" {
+			store.keys = append(store.keys, APIKey{Label: "dbsettings", Hash: GetHash(conf["apikey"])})
+		}
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(dat, &keys); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %v", fileName, err)
+	}
+	ids := make(map[string]struct{})
+	for i, key := range keys {
+		if key.ID != "" {
+			if In(ids, key.ID) {
+				return nil, fmt.Errorf("la clave %d (%s) de %s repite el id '%s'", i, key.Label, fileName, key.ID)
+			}
+			ids[key.ID] = struct{}{}
+		}
+		if len(key.Hash) != 64 {
+			return nil, fmt.Errorf("la clave %d (%s) de %s no tiene un hash SHA-256 válido", i, key.Label, fileName)
+		}
+		if _, err := key.expiry(); err != nil {
+			return nil, fmt.Errorf("la clave %d (%s) de %s tiene una fecha de vencimiento inválida: %v", i, key.Label, fileName, err)
+		}
+		keys[i].Hash = strings.ToLower(key.Hash)
+	}
+	return &KeyStore{keys: keys}, nil
+}
+
+// Authenticate busca la clave comparando hashes en tiempo constante,
+// se recorren todas las claves para no revelar cuál coincidió
+func (s *KeyStore) Authenticate(clave string) (*APIKey, error) {
+	hash := []byte(GetHash(clave))
+	var encontrada *APIKey
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(s.keys[i].Hash)) == 1 {
+			encontrada = &s.keys[i]
+		}
+	}
+	if encontrada == nil || clave == "" {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthInvalidKey, "invalid apikey")
+	}
+
+	if err := encontrada.checkExpiry(); err != nil {
+		return nil, err
+	}
+	return encontrada, nil
+}
+
+func (k *APIKey) checkExpiry() error {
+	vence, _ := k.expiry()
+	if !vence.IsZero() && time.Now().After(vence) {
+		return NewAPIError(http.StatusUnauthorized, CodeAuthKeyExpired, "apikey expired")
+	}
+	return nil
+}
+
+// Authorize comprueba que la solicitud esté dentro del alcance de la clave
+func (k *APIKey) Authorize(consulta Consulta) error {
+	if consulta.Query == "" && k.StoredOnly {
+		return NewAPIError(http.StatusForbidden, CodeAuthForbidden, "la apikey solo permite consultas guardadas")
+	}
+	if consulta.Query != "" && !allowed(k.Queries, consulta.Query) {
+		return forbidden("query", consulta.Query)
+	}
+	if !allowed(k.DbTypes, consulta.DbType) {
+		return forbidden("dbtype", consulta.DbType)
+	}
+	if !allowed(k.Dbnames, consulta.Dbname) {
+		return forbidden("dbname", consulta.Dbname)
+	}
+	if !allowed(k.Querytypes, consulta.Querytype) {
+		return forbidden("querytype", consulta.Querytype)
+	}
+	// en badgerdb cada sentencia del lote lleva su propia operación
+	if consulta.Querytype == "batch" && consulta.DbType == "badgerdb" {
+		for _, sentencia := range consulta.Statements {
+			if !allowed(k.Querytypes, sentencia.Querytype) {
+				return forbidden("querytype", sentencia.Querytype)
+			}
+		}
+	}
+	return nil
+}
+
+// AuthorizeAdmin comprueba que la clave permita operaciones de administración
+// sobre la base indicada
+func (k *APIKey) AuthorizeAdmin(dbtype, dbname string) error {
+	if !k.Admin {
+		return NewAPIError(http.StatusForbidden, CodeAuthForbidden, "la apikey no permite operaciones de administración")
+	}
+	if !allowed(k.DbTypes, dbtype) {
+		return forbidden("dbtype", dbtype)
+	}
+	if !allowed(k.Dbnames, dbname) {
+		return forbidden("dbname", dbname)
+	}
+	return nil
+}
+
+// expiry interpreta Expires como fecha (fin del día) o fecha y hora RFC3339
+func (k *APIKey) expiry() (time.Time, error) {
+	if k.Expires == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, k.Expires); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", k.Expires, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+func allowed(lista []string, valor string) bool {
+	if len(lista) == 0 {
+		return true
+	}
+	for _, v := range lista {
+		if v == valor || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func forbidden(campo, valor string) error {
+	return NewAPIError(http.StatusForbidden, CodeAuthForbidden, fmt.Sprintf("la apikey no permite %s '%s'", campo, valor))
+}
+
+// NewKey genera una clave aleatoria, la agrega a apikeys.json con acceso
+// completo y devuelve la clave y su id, solo se guarda su hash
+func NewKey(fileName, label string) (string, string, error) {
+	var keys []APIKey
+	if dat, err := os.ReadFile(fileName); err == nil {
+		if err := json.Unmarshal(dat, &keys); err != nil {
+			return "", "", fmt.Errorf("error leyendo %s: %v", fileName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", "", err
+	}
+
+	clave, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", "", err
+	}
+	keys = append(keys, APIKey{
+		Label:      label,
+		ID:         id,
+		Hash:       GetHash(clave),
+		DbTypes:    []string{},
+		Dbnames:    []string{},
+		Querytypes: []string{},
+	})
+
+	dat, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	// solo el usuario del servidor puede leer las claves
+	if err := UpdateFileMode(fileName, dat, 0600); err != nil {
+		return "", "", err
+	}
+	return clave, id, nil
+}
+
+// randomHex devuelve n bytes aleatorios en hex
+func randomHex(n int) (string, error) {
+	aleatorio := make([]byte, n)
+	if _, err := rand.Read(aleatorio); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(aleatorio), nil
+}
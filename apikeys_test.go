@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// errorCode devuelve el código de un APIError, "" si no lo es
+func errorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	hash := GetHash("clave")
+	casos := []struct {
+		nombre    string
+		contenido string // "" sin apikeys.json
+		conf      map[string]string
+		claves    int
+		error     string
+	}{
+		{"clave de dbsettings", "", map[string]string{"apikey": "clave"}, 1, ""},
+		{"sin ninguna clave", "", map[string]string{}, 0, ""},
+		{"apikey por defecto", "", map[string]string{"apikey": "apikey"}, 0, "valor por defecto"},
+		{"archivo", `[{"label":"a","hash":"` + strings.ToUpper(hash) + `"}]`, map[string]string{"apikey": "apikey"}, 1, ""},
+		{"hash inválido", `[{"label":"a","hash":"abc"}]`, nil, 0, "hash SHA-256"},
+		{"vencimiento inválido", `[{"label":"a","hash":"` + hash + `","expires":"mañana"}]`, nil, 0, "vencimiento inválida"},
+		{"json inválido", `{`, nil, 0, "error leyendo"},
+	}
+	for i, caso := range casos {
+		archivo := filepath.Join(dir, strings.Repeat("x", i+1)+".json")
+		if caso.contenido != "" {
+			if err := os.WriteFile(archivo, []byte(caso.contenido), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store, err := LoadKeyStore(archivo, caso.conf)
+		if caso.error != "" {
+			if err == nil || !strings.Contains(err.Error(), caso.error) {
+				t.Errorf("%s: obtenido %v, esperado %q", caso.nombre, err, caso.error)
+			}
+			continue
+		}
+		if err != nil || len(store.keys) != caso.claves {
+			t.Errorf("%s: %v %v", caso.nombre, store, err)
+			continue
+		}
+		// los hashes se comparan en minúsculas
+		if caso.claves > 0 {
+			if _, err := store.Authenticate("clave"); err != nil {
+				t.Errorf("%s: %v", caso.nombre, err)
+			}
+		}
+	}
+}
+
+func TestKeyStoreAuthenticate(t *testing.T) {
+	store := &KeyStore{keys: []APIKey{
+		{Label: "sin vencimiento", Hash: GetHash("a")},
+		{Label: "vencida", Hash: GetHash("b"), Expires: "2020-01-01"},
+		{Label: "vence hoy", Hash: GetHash("c"), Expires: time.Now().Format("2006-01-02")},
+		{Label: "vence en una hora", Hash: GetHash("d"), Expires: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{Label: "venció hace una hora", Hash: GetHash("e"), Expires: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+	}}
+	casos := []struct {
+		clave  string
+		label  string
+		codigo string
+	}{
+		{"a", "sin vencimiento", ""},
+		{"b", "", CodeAuthKeyExpired},
+		{"c", "vence hoy", ""},
+		{"d", "vence en una hora", ""},
+		{"e", "", CodeAuthKeyExpired},
+		{"z", "", CodeAuthInvalidKey},
+		{"", "", CodeAuthInvalidKey},
+	}
+	for _, caso := range casos {
+		key, err := store.Authenticate(caso.clave)
+		if caso.codigo != "" {
+			if errorCode(err) != caso.codigo {
+				t.Errorf("%q: obtenido %v, esperado %s", caso.clave, err, caso.codigo)
+			}
+		} else if err != nil || key.Label != caso.label {
+			t.Errorf("%q: obtenido %v %v, esperado %s", caso.clave, key, err, caso.label)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	lectura := &APIKey{DbTypes: []string{"sqlite3", "badgerdb"}, Dbnames: []string{"ventas.db", "kv"}, Querytypes: []string{"select", "list", "find", "batch"}}
+	comodin := &APIKey{DbTypes: []string{"*"}, Dbnames: []string{"*"}, Querytypes: []string{"*"}}
+	casos := []struct {
+		nombre   string
+		key      *APIKey
+		consulta Consulta
+		campo    string // "" si debe autorizar
+	}{
+		{"sin listas", &APIKey{}, Consulta{DbType: "mysql", Dbname: "x", Querytype: "alter"}, ""},
+		{"comodín", comodin, Consulta{DbType: "mysql", Dbname: "x", Querytype: "alter"}, ""},
+		{"dentro del alcance", lectura, Consulta{DbType: "sqlite3", Dbname: "ventas.db", Querytype: "select"}, ""},
+		{"otro dbtype", lectura, Consulta{DbType: "mysql", Dbname: "ventas.db", Querytype: "select"}, "dbtype 'mysql'"},
+		{"otra base", lectura, Consulta{DbType: "sqlite3", Dbname: "otra.db", Querytype: "select"}, "dbname 'otra.db'"},
+		{"otra operación", lectura, Consulta{DbType: "sqlite3", Dbname: "ventas.db", Querytype: "exec"}, "querytype 'exec'"},
+		{"lote badger de lectura", lectura, Consulta{DbType: "badgerdb", Dbname: "kv", Querytype: "batch",
+			Statements: []BatchStatement{{Querytype: "list"}, {Querytype: "find"}}}, ""},
+		{"lote badger con escritura", lectura, Consulta{DbType: "badgerdb", Dbname: "kv", Querytype: "batch",
+			Statements: []BatchStatement{{Querytype: "list"}, {Querytype: "delete"}}}, "querytype 'delete'"},
+	}
+	for _, caso := range casos {
+		err := caso.key.Authorize(caso.consulta)
+		if caso.campo == "" {
+			if err != nil {
+				t.Errorf("%s: %v", caso.nombre, err)
+			}
+		} else if errorCode(err) != CodeAuthForbidden || !strings.Contains(err.Error(), caso.campo) {
+			t.Errorf("%s: obtenido %v, esperado %s", caso.nombre, err, caso.campo)
+		}
+	}
+}
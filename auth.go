@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signingKeyFile guarda el secreto maestro del que se derivan los secretos de
+// firma de las claves, está fuera de apikeys.json para que leer ese archivo no
+// alcance para firmar solicitudes
+const signingKeyFile = "signing.key"
+
+// Authenticator obtiene la apikey de la solicitud: firmada con HMAC, en la
+// cabecera Authorization/X-API-Key o, si no hay cabeceras, en el cuerpo JSON
+type Authenticator struct {
+	keys             *KeyStore
+	maestro          []byte // secreto maestro de las firmas (ver SigningSecret)
+	window           time.Duration
+	requireSignature bool
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewAuthenticator(keys *KeyStore, maestro []byte, conf map[string]string) *Authenticator {
+	window := 5 * time.Minute
+	if v, ok := conf["signaturewindow"]; ok {
+		window = time.Duration(ParseInt(v)) * time.Second
+	}
+	return &Authenticator{
+		keys:             keys,
+		maestro:          maestro,
+		window:           window,
+		requireSignature: conf["requiresignature"] == "true",
+		nonces:           make(map[string]time.Time),
+	}
+}
+
+// LoadSigningKey lee el secreto maestro de fileName, la primera vez lo genera
+// y lo guarda con permisos 0600
+func LoadSigningKey(fileName string) ([]byte, error) {
+	dat, err := os.ReadFile(fileName)
+	if err == nil {
+		maestro, err := hex.DecodeString(strings.TrimSpace(string(dat)))
+		if err != nil || len(maestro) < 32 {
+			return nil, fmt.Errorf("%s no contiene un secreto válido", fileName)
+		}
+		return maestro, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	maestro := make([]byte, 32)
+	if _, err := rand.Read(maestro); err != nil {
+		return nil, err
+	}
+	archivo, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error creando %s: %v", fileName, err)
+	}
+	_, err = archivo.WriteString(hex.EncodeToString(maestro))
+	if cerr := archivo.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error escribiendo %s: %v", fileName, err)
+	}
+	return maestro, nil
+}
+
+// SigningSecret es el secreto de firma de la clave con identificador id:
+// HMAC-SHA256(secreto maestro, id) en hex. No se guarda, se entrega al crear
+// la clave y el servidor lo vuelve a calcular en cada solicitud firmada
+func SigningSecret(maestro []byte, id string) string {
+	mac := hmac.New(sha256.New, maestro)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Authenticator) Authenticate(c *gin.Context, bodyKey string) (*APIKey, error) {
+	if c.GetHeader("X-Signature") != "" {
+		return a.verifySignature(c)
+	}
+	if a.requireSignature {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthSignature, "se requiere una solicitud firmada")
+	}
+
+	clave := c.GetHeader("X-API-Key")
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		clave = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if clave == "" {
+		clave = bodyKey
+	}
+	return a.keys.Authenticate(clave)
+}
+
+// verifySignature valida X-Key-Id, X-Timestamp, X-Nonce y X-Signature. La firma es
+// HMAC-SHA256 con el secreto de firma de la clave (ver SigningSecret) sobre:
+// timestamp \n nonce \n método \n ruta \n sha256(cuerpo)
+func (a *Authenticator) verifySignature(c *gin.Context) (*APIKey, error) {
+	keyID := c.GetHeader("X-Key-Id")
+	timestamp := c.GetHeader("X-Timestamp")
+	nonce := c.GetHeader("X-Nonce")
+	firma := c.GetHeader("X-Signature")
+	if keyID == "" || timestamp == "" || nonce == "" {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthSignature, "faltan las cabeceras X-Key-Id, X-Timestamp o X-Nonce")
+	}
+
+	segundos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthSignature, "X-Timestamp inválido")
+	}
+	enviado := time.Unix(segundos, 0)
+	if diferencia := time.Since(enviado); diferencia > a.window || diferencia < -a.window {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthStale, "solicitud vencida, revise el reloj del cliente")
+	}
+
+	key := a.keys.ByID(keyID)
+	if key == nil {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthInvalidKey, "invalid apikey")
+	}
+
+	body, err := rawBody(c)
+	if err != nil {
+		return nil, err
+	}
+	hashCuerpo := sha256.Sum256(body)
+	mensaje := strings.Join([]string{timestamp, nonce, c.Request.Method, c.Request.URL.Path, hex.EncodeToString(hashCuerpo[:])}, "\n")
+	mac := hmac.New(sha256.New, []byte(SigningSecret(a.maestro, key.ID)))
+	mac.Write([]byte(mensaje))
+	esperada := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(esperada), []byte(strings.ToLower(firma))) {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthSignature, "firma inválida")
+	}
+
+	// la firma es válida, ahora se descartan las repeticiones
+	if !a.useNonce(keyID+":"+nonce, enviado) {
+		return nil, NewAPIError(http.StatusUnauthorized, CodeAuthReplay, "nonce ya utilizado")
+	}
+
+	if err := key.checkExpiry(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// useNonce registra el nonce y devuelve false si ya se había usado dentro de la ventana
+func (a *Authenticator) useNonce(nonce string, enviado time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ahora := time.Now()
+	if ahora.Sub(a.lastSweep) > a.window {
+		for n, vence := range a.nonces {
+			if ahora.After(vence) {
+				delete(a.nonces, n)
+			}
+		}
+		a.lastSweep = ahora
+	}
+
+	if vence, ok := a.nonces[nonce]; ok && ahora.Before(vence) {
+		return false
+	}
+	// se guarda hasta que el timestamp deje de ser aceptado
+	a.nonces[nonce] = enviado.Add(a.window)
+	return true
+}
+
+// maxBodyBytes es el tamaño máximo del cuerpo de una solicitud, que se lee
+// entero antes de autenticarla para verificar la firma
+var maxBodyBytes int64 = 10 << 20
+
+// InitBodyLimit lee el tamaño máximo del cuerpo (maxbodybytes) de dbsettings.json
+func InitBodyLimit(conf map[string]string) {
+	if n := ParseInt(conf["maxbodybytes"]); n > 0 {
+		maxBodyBytes = n
+	}
+}
+
+// rawBody devuelve el cuerpo guardado por ShouldBindBodyWith o lo lee, hasta
+// maxBodyBytes
+func rawBody(c *gin.Context) ([]byte, error) {
+	if cached, ok := c.Get(gin.BodyBytesKey); ok {
+		if body, ok := cached.([]byte); ok {
+			return body, nil
+		}
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+	if err != nil {
+		var excedido *http.MaxBytesError
+		if errors.As(err, &excedido) {
+			return nil, fmt.Errorf("el cuerpo de la solicitud supera los %d bytes permitidos", maxBodyBytes)
+		}
+		return nil, fmt.Errorf("error leyendo el cuerpo de la solicitud: %v", err)
+	}
+	c.Set(gin.BodyBytesKey, body)
+	return body, nil
+}
+
+// ByID busca una clave por su id recorriendo todas en tiempo constante, las
+// claves sin id no pueden firmar solicitudes
+func (s *KeyStore) ByID(id string) *APIKey {
+	var encontrada *APIKey
+	for i := range s.keys {
+		if s.keys[i].ID != "" && subtle.ConstantTimeCompare([]byte(id), []byte(s.keys[i].ID)) == 1 {
+			encontrada = &s.keys[i]
+		}
+	}
+	return encontrada
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signRequest firma la solicitud como lo haría un cliente
+func signRequest(secreto, timestamp, nonce, metodo, ruta, cuerpo string) string {
+	hashCuerpo := sha256.Sum256([]byte(cuerpo))
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(strings.Join([]string{timestamp, nonce, metodo, ruta, hex.EncodeToString(hashCuerpo[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func testContext(cuerpo string, cabeceras map[string]string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(cuerpo))
+	for nombre, valor := range cabeceras {
+		c.Request.Header.Set(nombre, valor)
+	}
+	return c
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	maestro := []byte(strings.Repeat("m", 32))
+	store := &KeyStore{keys: []APIKey{
+		{Label: "firma", ID: "k1", Hash: GetHash("clave-firma")},
+		{Label: "vencida", ID: "k2", Hash: GetHash("clave-vencida"), Expires: "2020-01-01"},
+	}}
+	auth := NewAuthenticator(store, maestro, map[string]string{"signaturewindow": "60"})
+	secreto := SigningSecret(maestro, "k1")
+	const cuerpo = `{"dbtype":"sqlite3","dbname":"a.db","querytype":"select","dbquery":"SELECT 1"}`
+	ahora := strconv.FormatInt(time.Now().Unix(), 10)
+
+	casos := []struct {
+		nombre    string
+		id        string
+		timestamp string
+		nonce     string
+		firma     string // "" firma correctamente el cuerpo enviado
+		cuerpo    string // cuerpo enviado, distinto del firmado si no es ""
+		codigo    string // "" si debe autenticar
+	}{
+		{"válida", "k1", ahora, "n1", "", "", ""},
+		{"firma de otro secreto", "k1", ahora, "n2", signRequest("otro", ahora, "n2", "POST", "/", cuerpo), "", CodeAuthSignature},
+		{"firma en mayúsculas", "k1", ahora, "n3", strings.ToUpper(signRequest(secreto, ahora, "n3", "POST", "/", cuerpo)), "", ""},
+		{"cuerpo modificado", "k1", ahora, "n4", "", strings.Replace(cuerpo, "SELECT 1", "DELETE FROM t", 1), CodeAuthSignature},
+		{"otra ruta", "k1", ahora, "n5", signRequest(secreto, ahora, "n5", "POST", "/admin/restore", cuerpo), "", CodeAuthSignature},
+		{"id desconocido", "k9", ahora, "n6", "", "", CodeAuthInvalidKey},
+		{"sin nonce", "k1", ahora, "", "", "", CodeAuthSignature},
+		{"timestamp inválido", "k1", "ayer", "n7", "", "", CodeAuthSignature},
+		{"reloj atrasado", "k1", strconv.FormatInt(time.Now().Add(-61*time.Second).Unix(), 10), "n8", "", "", CodeAuthStale},
+		{"reloj adelantado", "k1", strconv.FormatInt(time.Now().Add(61*time.Second).Unix(), 10), "n9", "", "", CodeAuthStale},
+		{"dentro de la ventana", "k1", strconv.FormatInt(time.Now().Add(-50*time.Second).Unix(), 10), "n10", "", "", ""},
+		{"nonce repetido", "k1", ahora, "n1", "", "", CodeAuthReplay},
+		{"clave vencida", "k2", ahora, "n11", "", "", CodeAuthKeyExpired},
+	}
+	for _, caso := range casos {
+		firma := caso.firma
+		if firma == "" {
+			firma = signRequest(SigningSecret(maestro, caso.id), caso.timestamp, caso.nonce, "POST", "/", cuerpo)
+		}
+		enviado := cuerpo
+		if caso.cuerpo != "" {
+			enviado = caso.cuerpo
+		}
+		c := testContext(enviado, map[string]string{"X-Key-Id": caso.id, "X-Timestamp": caso.timestamp, "X-Nonce": caso.nonce, "X-Signature": firma})
+		key, err := auth.Authenticate(c, "")
+		if caso.codigo == "" {
+			if err != nil || key == nil || key.ID != caso.id {
+				t.Errorf("%s: error %v", caso.nombre, err)
+			}
+		} else if errorCode(err) != caso.codigo {
+			t.Errorf("%s: obtenido %v (%s), esperado %s", caso.nombre, err, errorCode(err), caso.codigo)
+		}
+	}
+
+	// el mismo nonce con otra clave no es una repetición
+	store.keys = append(store.keys, APIKey{Label: "otra", ID: "k3", Hash: GetHash("clave-otra")})
+	firma := signRequest(SigningSecret(maestro, "k3"), ahora, "n1", "POST", "/", cuerpo)
+	c := testContext(cuerpo, map[string]string{"X-Key-Id": "k3", "X-Timestamp": ahora, "X-Nonce": "n1", "X-Signature": firma})
+	if _, err := auth.Authenticate(c, ""); err != nil {
+		t.Errorf("nonce de otra clave: %v", err)
+	}
+}
+
+func TestAuthenticateApikey(t *testing.T) {
+	store := &KeyStore{keys: []APIKey{{Label: "a", ID: "k1", Hash: GetHash("clave")}}}
+	casos := []struct {
+		nombre    string
+		conf      map[string]string
+		cabeceras map[string]string
+		bodyKey   string
+		codigo    string
+	}{
+		{"bearer", nil, map[string]string{"Authorization": "Bearer clave"}, "", ""},
+		{"x-api-key", nil, map[string]string{"X-API-Key": "clave"}, "", ""},
+		{"cuerpo", nil, nil, "clave", ""},
+		{"la cabecera tiene prioridad", nil, map[string]string{"X-API-Key": "otra"}, "clave", CodeAuthInvalidKey},
+		{"vacía", nil, nil, "", CodeAuthInvalidKey},
+		{"firma obligatoria", map[string]string{"requiresignature": "true"}, map[string]string{"Authorization": "Bearer clave"}, "", CodeAuthSignature},
+	}
+	for _, caso := range casos {
+		auth := NewAuthenticator(store, []byte(strings.Repeat("m", 32)), caso.conf)
+		_, err := auth.Authenticate(testContext("{}", caso.cabeceras), caso.bodyKey)
+		if errorCode(err) != caso.codigo {
+			t.Errorf("%s: obtenido %v, esperado %s", caso.nombre, err, caso.codigo)
+		}
+	}
+}
+
+func TestRawBodyLimit(t *testing.T) {
+	anterior := maxBodyBytes
+	defer func() { maxBodyBytes = anterior }()
+	InitBodyLimit(map[string]string{"maxbodybytes": "16"})
+
+	if body, err := rawBody(testContext(strings.Repeat("a", 16), nil)); err != nil || len(body) != 16 {
+		t.Errorf("cuerpo en el límite: %d %v", len(body), err)
+	}
+	if _, err := rawBody(testContext(strings.Repeat("a", 17), nil)); err == nil || !strings.Contains(err.Error(), "16 bytes") {
+		t.Errorf("cuerpo excedido: %v", err)
+	}
+	// sin firma válida tampoco se lee más allá del límite
+	auth := NewAuthenticator(&KeyStore{keys: []APIKey{{ID: "k1", Hash: GetHash("clave")}}}, []byte(strings.Repeat("m", 32)), nil)
+	c := testContext(strings.Repeat("a", 1<<20), map[string]string{"X-Key-Id": "k1", "X-Timestamp": strconv.FormatInt(time.Now().Unix(), 10), "X-Nonce": "n", "X-Signature": "00"})
+	if _, err := auth.Authenticate(c, ""); err == nil || !strings.Contains(err.Error(), "16 bytes") {
+		t.Errorf("cuerpo excedido con firma: %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type BackupConfig struct {
+	User      string
+	Password  string
+	Host      string
+	Port      string
+	Database  string
+	BackupDir string
+
+	InsertRows  int    // filas por INSERT
+	InsertBytes int    // bytes por INSERT
+	Compression string // "", gzip o zstd
+}
+
+// el nombre de cada respaldo es <base>_<fecha y hora><extensión>, los de
+// versiones anteriores solo tienen la fecha y se tratan como de las 00:00
+const (
+	backupTimeLayout   = "2006-01-02_150405"
+	backupLegacyLayout = "2006-01-02"
+)
+
+// horario de los respaldos si dbsettings.json no define backupschedule
+const defaultBackupSchedule = "0 * * * *"
+
+// backupName devuelve la ruta del respaldo de base creado en t, sin extensión
+func backupName(dir, base string, t time.Time) string {
+	return filepath.Join(dir, base+"_"+t.Format(backupTimeLayout))
+}
+
+// RetentionPolicy indica qué respaldos se conservan: los Last más recientes y
+// el último de cada uno de los Daily días, Weekly semanas y Monthly meses más
+// recientes que tienen respaldo (abuelo-padre-hijo). Los demás se borran. Un
+// valor 0 desactiva esa regla y con todos en 0 no se borra nada
+type RetentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func (p RetentionPolicy) Enabled() bool {
+	return p.Last > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0
+}
+
+// backupEntry es un respaldo existente en la carpeta de respaldos
+type backupEntry struct {
+	Path string
+	Time time.Time
+}
+
+// listBackups devuelve los respaldos de base en dir, del más nuevo al más viejo
+func listBackups(dir, base string) ([]backupEntry, error) {
+	archivos, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la carpeta de respaldos: %v", err)
+	}
+	prefijo := base + "_"
+	var respaldos []backupEntry
+	for _, archivo := range archivos {
+		nombre := archivo.Name()
+		if archivo.IsDir() || !strings.HasPrefix(nombre, prefijo) || strings.HasSuffix(nombre, ".tmp") {
+			continue
+		}
+		if fecha, ok := parseBackupTime(strings.TrimPrefix(nombre, prefijo)); ok {
+			respaldos = append(respaldos, backupEntry{Path: filepath.Join(dir, nombre), Time: fecha})
+		}
+	}
+	sort.Slice(respaldos, func(i, j int) bool {
+		return respaldos[i].Time.After(respaldos[j].Time)
+	})
+	return respaldos, nil
+}
+
+// parseBackupTime lee la fecha al inicio de resto, seguida de la extensión
+func parseBackupTime(resto string) (time.Time, bool) {
+	for _, layout := range []string{backupTimeLayout, backupLegacyLayout} {
+		if len(resto) <= len(layout) || resto[len(layout)] != '.' {
+			continue
+		}
+		if fecha, err := time.ParseInLocation(layout, resto[:len(layout)], time.Local); err == nil {
+			return fecha, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Keep marca los respaldos que se conservan según su fecha, fechas va del más
+// nuevo al más viejo
+func (p RetentionPolicy) Keep(fechas []time.Time) []bool {
+	conservar := make([]bool, len(fechas))
+	for i := range fechas {
+		if i < p.Last {
+			conservar[i] = true
+		}
+	}
+	periodos := []struct {
+		cantidad int
+		clave    func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			anio, semana := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", anio, semana)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, periodo := range periodos {
+		vistos := map[string]bool{}
+		for i, fecha := range fechas {
+			if len(vistos) >= periodo.cantidad {
+				break
+			}
+			clave := periodo.clave(fecha)
+			if !vistos[clave] {
+				vistos[clave] = true
+				conservar[i] = true
+			}
+		}
+	}
+	return conservar
+}
+
+// PruneBackups borra los respaldos de base en dir que la política no conserva
+func PruneBackups(dir, base string, politica RetentionPolicy) ([]string, error) {
+	if !politica.Enabled() {
+		return nil, nil
+	}
+	respaldos, err := listBackups(dir, base)
+	if err != nil {
+		return nil, err
+	}
+	fechas := make([]time.Time, len(respaldos))
+	for i, respaldo := range respaldos {
+		fechas[i] = respaldo.Time
+	}
+	var borrar []string
+	for i, conservar := range politica.Keep(fechas) {
+		if !conservar {
+			borrar = append(borrar, respaldos[i].Path)
+		}
+	}
+	return removeBackups(borrar)
+}
+
+// removeBackups borra los archivos y devuelve los que se borraron
+func removeBackups(rutas []string) ([]string, error) {
+	var borrados []string
+	for _, ruta := range rutas {
+		if err := os.Remove(ruta); err != nil {
+			return borrados, fmt.Errorf("error borrando respaldo: %v", err)
+		}
+		borrados = append(borrados, ruta)
+	}
+	return borrados, nil
+}
+
+// BackupScheduler crea los respaldos según la expresión cron backupschedule y
+// después aplica la política de retención. Respalda la base MySQL dbname (con
+// dbtype mysql) en la carpeta de respaldos y cada base sqlite3 y badgerdb de la
+// carpeta de datos en las subcarpetas sqlite3 y badgerdb
+type BackupScheduler struct {
+	horario    *CronSchedule
+	retencion  RetentionPolicy
+	dir        string
+	compresion string
+	mysql      *BackupConfig // nil si dbtype no es mysql
+
+	// respaldos incrementales de badger entre dos completos, 0 hace siempre completos
+	badgerIncrementals int
+	// respalda todas las bases al iniciar, además de en cada horario
+	alIniciar bool
+}
+
+// NewBackupScheduler lee el horario, la retención y los datos de conexión de conf
+func NewBackupScheduler(conf map[string]string) (*BackupScheduler, error) {
+	expresion := conf["backupschedule"]
+	if strings.TrimSpace(expresion) == "" {
+		expresion = defaultBackupSchedule
+	}
+	horario, err := ParseCron(expresion)
+	if err != nil {
+		return nil, fmt.Errorf("error en backupschedule: %v", err)
+	}
+	if horario.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("error en backupschedule: la expresión '%s' nunca se cumple", expresion)
+	}
+	if _, ok := compressionExtensions[conf["backupcompression"]]; !ok {
+		return nil, fmt.Errorf("error en backupcompression: compresión '%s' no soportada, use gzip o zstd", conf["backupcompression"])
+	}
+
+	s := &BackupScheduler{
+		horario: horario,
+		retencion: RetentionPolicy{
+			Last:    int(ParseInt(conf["backupkeeplast"])),
+			Daily:   int(ParseInt(conf["backupkeepdaily"])),
+			Weekly:  int(ParseInt(conf["backupkeepweekly"])),
+			Monthly: int(ParseInt(conf["backupkeepmonthly"])),
+		},
+		dir:                defaultBackupDir,
+		compresion:         conf["backupcompression"],
+		badgerIncrementals: int(ParseInt(conf["backupbadgerincrementals"])),
+		alIniciar:          conf["backuponstart"] != "false",
+	}
+	if conf["dbtype"] == "mysql" {
+		if err := ValidateMysqlName(conf["dbname"]); err != nil {
+			return nil, fmt.Errorf("error en dbname: %v", err)
+		}
+		s.mysql = &BackupConfig{
+			User:      conf["dbuser"],
+			Password:  conf["dbpass"],
+			Host:      conf["dbhost"],
+			Port:      conf["dbport"],
+			Database:  conf["dbname"],
+			BackupDir: s.dir,
+
+			InsertRows:  int(ParseInt(conf["backupinsertrows"])),
+			InsertBytes: int(ParseInt(conf["backupinsertbytes"])),
+			Compression: s.compresion,
+		}
+		if s.mysql.Port == "" {
+			s.mysql.Port = "3306"
+		}
+		if s.mysql.InsertRows <= 0 {
+			s.mysql.InsertRows = 1000
+		}
+		if s.mysql.InsertBytes <= 0 {
+			s.mysql.InsertBytes = 1 << 20
+		}
+	}
+	return s, nil
+}
+
+// Run crea los respaldos al iniciar (salvo backuponstart "false") y en cada
+// horario hasta que se cancela ctx
+func (s *BackupScheduler) Run(ctx context.Context) {
+	PrintGreen("Iniciando respaldo de bases de datos en la carpeta " + s.dir + "...")
+	for _, dir := range []string{s.dir, filepath.Join(s.dir, "sqlite3"), filepath.Join(s.dir, "badgerdb")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if s.alIniciar {
+		s.backup(ctx)
+	}
+	for {
+		siguiente := s.horario.Next(time.Now())
+		log.Printf("Próximo respaldo: %s", siguiente.Format("2006-01-02 15:04"))
+		espera := time.NewTimer(time.Until(siguiente))
+		select {
+		case <-ctx.Done():
+			espera.Stop()
+			return
+		case <-espera.C:
+		}
+		s.backup(ctx)
+	}
+}
+
+// backup respalda todas las bases, un error en una no detiene las demás
+func (s *BackupScheduler) backup(ctx context.Context) {
+	if s.mysql != nil {
+		if err := createBackup(ctx, *s.mysql); err != nil {
+			log.Printf("Error en backup de %s: %v", s.mysql.Database, err)
+		} else {
+			s.prune(PruneBackups, s.dir, s.mysql.Database)
+		}
+	}
+
+	bases, err := ListStores()
+	if err != nil {
+		log.Printf("Error en backup: %v", err)
+		return
+	}
+	for _, base := range bases {
+		if ctx.Err() != nil {
+			return
+		}
+		dir := filepath.Join(s.dir, base.DbType)
+		if base.DbType == "sqlite3" {
+			err = backupSqlite(ctx, base, dir, s.compresion)
+		} else {
+			err = backupBadger(ctx, base, dir, s.compresion, s.badgerIncrementals)
+		}
+		if err != nil {
+			log.Printf("Error en backup de %s: %v", base.Name, err)
+			continue
+		}
+		if base.DbType == "sqlite3" {
+			s.prune(PruneBackups, dir, base.Name)
+		} else {
+			s.prune(PruneBadgerBackups, dir, base.Name)
+		}
+	}
+}
+
+// prune aplica la política de retención a los respaldos de base en dir
+func (s *BackupScheduler) prune(podar func(dir, base string, politica RetentionPolicy) ([]string, error), dir, base string) {
+	borrados, err := podar(dir, base, s.retencion)
+	for _, ruta := range borrados {
+		log.Printf("Respaldo borrado por la política de retención: %s", ruta)
+	}
+	if err != nil {
+		log.Printf("Error en retención de respaldos: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	fecha := func(anio int, mes time.Month, dia, hora, minuto int) time.Time {
+		return time.Date(anio, mes, dia, hora, minuto, 0, 0, time.UTC)
+	}
+	casos := []struct {
+		nombre   string
+		politica RetentionPolicy
+		fechas   []time.Time // del más nuevo al más viejo
+		esperado []bool
+	}{
+		{"últimos", RetentionPolicy{Last: 2},
+			[]time.Time{fecha(2026, 10, 18, 3, 0), fecha(2026, 10, 18, 2, 0), fecha(2026, 10, 18, 1, 0)},
+			[]bool{true, true, false}},
+		{"más reglas que respaldos", RetentionPolicy{Last: 5, Daily: 5, Weekly: 5, Monthly: 5},
+			[]time.Time{fecha(2026, 10, 18, 3, 0), fecha(2026, 10, 18, 2, 0)},
+			[]bool{true, true}},
+		{"diario en el límite de medianoche", RetentionPolicy{Daily: 2},
+			[]time.Time{fecha(2026, 10, 18, 23, 59), fecha(2026, 10, 18, 0, 0), fecha(2026, 10, 17, 23, 59), fecha(2026, 10, 17, 0, 1), fecha(2026, 10, 16, 12, 0)},
+			[]bool{true, false, true, false, false}},
+		{"días sin respaldo no cuentan", RetentionPolicy{Daily: 2},
+			[]time.Time{fecha(2026, 10, 18, 1, 0), fecha(2026, 10, 10, 1, 0), fecha(2026, 10, 1, 1, 0)},
+			[]bool{true, true, false}},
+		// 2026 tiene 53 semanas ISO: del lunes 28 de diciembre al domingo 3 de enero es la semana 2026-53
+		{"semanal en el cambio de año", RetentionPolicy{Weekly: 2},
+			[]time.Time{fecha(2027, 1, 3, 12, 0), fecha(2027, 1, 1, 12, 0), fecha(2026, 12, 28, 0, 0), fecha(2026, 12, 27, 23, 59), fecha(2026, 12, 21, 0, 0), fecha(2026, 12, 20, 12, 0)},
+			[]bool{true, false, false, true, false, false}},
+		{"semanal de lunes a domingo", RetentionPolicy{Weekly: 3},
+			[]time.Time{fecha(2026, 10, 19, 0, 0), fecha(2026, 10, 18, 23, 59), fecha(2026, 10, 12, 0, 0), fecha(2026, 10, 11, 0, 0)},
+			[]bool{true, true, false, true}},
+		{"mensual en el cambio de mes", RetentionPolicy{Monthly: 2},
+			[]time.Time{fecha(2026, 11, 1, 0, 0), fecha(2026, 10, 31, 23, 59), fecha(2026, 10, 1, 0, 0), fecha(2026, 9, 30, 23, 59)},
+			[]bool{true, true, false, false}},
+		{"abuelo-padre-hijo", RetentionPolicy{Last: 1, Daily: 2, Weekly: 2, Monthly: 3},
+			[]time.Time{
+				fecha(2026, 10, 18, 3, 0), // último, día 18, semana 42, octubre
+				fecha(2026, 10, 18, 2, 0), // nada
+				fecha(2026, 10, 17, 3, 0), // día 17
+				fecha(2026, 10, 16, 3, 0), // nada, ya hay 2 días
+				fecha(2026, 10, 11, 3, 0), // semana 41
+				fecha(2026, 10, 4, 3, 0),  // nada, ya hay 2 semanas
+				fecha(2026, 9, 30, 3, 0),  // septiembre
+				fecha(2026, 8, 31, 3, 0),  // agosto
+				fecha(2026, 7, 31, 3, 0),  // nada, ya hay 3 meses
+			},
+			[]bool{true, false, true, false, true, false, true, true, false}},
+		{"sin política", RetentionPolicy{},
+			[]time.Time{fecha(2026, 10, 18, 3, 0)},
+			[]bool{false}},
+	}
+	for _, caso := range casos {
+		if obtenido := caso.politica.Keep(caso.fechas); !reflect.DeepEqual(obtenido, caso.esperado) {
+			t.Errorf("%s: obtenido %v, esperado %v", caso.nombre, obtenido, caso.esperado)
+		}
+	}
+	if (RetentionPolicy{}).Enabled() || !(RetentionPolicy{Monthly: 1}).Enabled() {
+		t.Error("Enabled: una política es activa si alguna regla es mayor que 0")
+	}
+}
+
+func TestParseBackupTime(t *testing.T) {
+	casos := []struct {
+		resto    string
+		esperado time.Time
+		ok       bool
+	}{
+		{"2026-10-18_030000.sql", time.Date(2026, 10, 18, 3, 0, 0, 0, time.Local), true},
+		{"2026-10-18_030000.sql.gz", time.Date(2026, 10, 18, 3, 0, 0, 0, time.Local), true},
+		{"2026-10-18.sql", time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local), true},
+		{"2026-10-18_030000", time.Time{}, false},
+		{"2026-13-18_030000.sql", time.Time{}, false},
+		{"copia.sql", time.Time{}, false},
+	}
+	for _, caso := range casos {
+		obtenido, ok := parseBackupTime(caso.resto)
+		if ok != caso.ok || !obtenido.Equal(caso.esperado) {
+			t.Errorf("%q: obtenido %s %v, esperado %s %v", caso.resto, obtenido, ok, caso.esperado, caso.ok)
+		}
+	}
+}
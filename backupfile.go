@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compresiones de los archivos de respaldo (backupcompression en dbsettings.json)
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// extensión que se agrega al nombre del respaldo según la compresión
+var compressionExtensions = map[string]string{
+	CompressionNone: "",
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// carpeta de los respaldos, relativa al directorio de trabajo
+const defaultBackupDir = "static"
+
+// tamaño del buffer de escritura de los respaldos
+const backupBufferSize = 256 << 10
+
+// backupFile escribe un respaldo con buffer y, opcionalmente, comprimido. Se
+// escribe en un archivo temporal que Commit renombra al nombre final; Abort lo
+// descarta y el respaldo anterior con el mismo nombre se mantiene
+type backupFile struct {
+	Name string // nombre final, con la extensión de la compresión
+
+	archivo   *os.File
+	compresor io.WriteCloser // nil sin compresión
+	*bufio.Writer
+}
+
+// createBackupFile crea el respaldo nombre (sin la extensión de compresión)
+func createBackupFile(nombre, compresion string) (*backupFile, error) {
+	extension, ok := compressionExtensions[compresion]
+	if !ok {
+		return nil, fmt.Errorf("compresión '%s' no soportada, use gzip o zstd", compresion)
+	}
+	b := &backupFile{Name: nombre + extension}
+	archivo, err := os.Create(b.Name + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creando archivo: %v", err)
+	}
+	b.archivo = archivo
+
+	var destino io.Writer = archivo
+	switch compresion {
+	case CompressionGzip:
+		b.compresor = gzip.NewWriter(archivo)
+	case CompressionZstd:
+		if b.compresor, err = zstd.NewWriter(archivo); err != nil {
+			archivo.Close()
+			os.Remove(archivo.Name())
+			return nil, fmt.Errorf("error iniciando zstd: %v", err)
+		}
+	}
+	if b.compresor != nil {
+		destino = b.compresor
+	}
+	b.Writer = bufio.NewWriterSize(destino, backupBufferSize)
+	return b, nil
+}
+
+// Commit vacía el buffer, termina la compresión y renombra el archivo temporal
+func (b *backupFile) Commit() error {
+	err := b.Flush()
+	if b.compresor != nil {
+		if cerr := b.compresor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := b.archivo.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(b.archivo.Name())
+		return fmt.Errorf("error escribiendo archivo: %v", err)
+	}
+	if err := os.Rename(b.archivo.Name(), b.Name); err != nil {
+		os.Remove(b.archivo.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort descarta el archivo temporal
+func (b *backupFile) Abort() {
+	if b.compresor != nil {
+		b.compresor.Close()
+	}
+	b.archivo.Close()
+	os.Remove(b.archivo.Name())
+}
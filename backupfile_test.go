@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// readBackupFile lee un respaldo descomprimiéndolo según su extensión
+func readBackupFile(t *testing.T, ruta string) string {
+	t.Helper()
+	archivo, err := os.Open(ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archivo.Close()
+	var lector io.Reader = archivo
+	switch filepath.Ext(ruta) {
+	case ".gz":
+		if lector, err = gzip.NewReader(archivo); err != nil {
+			t.Fatal(err)
+		}
+	case ".zst":
+		decoder, err := zstd.NewReader(archivo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		lector = decoder
+	}
+	dat, err := io.ReadAll(lector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(dat)
+}
+
+func TestBackupFile(t *testing.T) {
+	dir := t.TempDir()
+	// valores con comillas, barras, NUL y binario, más grandes que el buffer
+	fila := "(" + strings.Join([]string{
+		dumpValue(sql.RawBytes("O'Brien \\ \"x\"\x00\r\n\x1a"), "VARCHAR"),
+		dumpValue(sql.RawBytes{0, 0xff, '\'', '\\'}, "BLOB"),
+		dumpValue(nil, "INT"),
+	}, ",") + ")"
+	contenido := "INSERT INTO `t` (`a`,`b`,`c`) VALUES\n" + strings.Repeat(fila+",\n", backupBufferSize/len(fila)+10) + fila + ";\n"
+
+	for compresion, extension := range compressionExtensions {
+		nombre := filepath.Join(dir, "base_"+compresion+".sql")
+		archivo, err := createBackupFile(nombre, compresion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if archivo.Name != nombre+extension {
+			t.Errorf("%q: nombre %s", compresion, archivo.Name)
+		}
+		if _, err := archivo.WriteString(contenido); err != nil {
+			t.Fatal(err)
+		}
+		// hasta Commit solo existe el temporal
+		if _, err := os.Stat(archivo.Name); !os.IsNotExist(err) {
+			t.Errorf("%q: el respaldo existe antes de Commit: %v", compresion, err)
+		}
+		if err := archivo.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if leido := readBackupFile(t, archivo.Name); leido != contenido {
+			t.Errorf("%q: el contenido leído no coincide (%d bytes, esperado %d)", compresion, len(leido), len(contenido))
+		}
+		if _, err := os.Stat(archivo.Name + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("%q: quedó el temporal: %v", compresion, err)
+		}
+
+		// Abort mantiene el respaldo anterior con el mismo nombre
+		otro, err := createBackupFile(nombre, compresion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otro.WriteString("incompleto")
+		otro.Abort()
+		if leido := readBackupFile(t, archivo.Name); leido != contenido {
+			t.Errorf("%q: Abort modificó el respaldo anterior", compresion)
+		}
+		if _, err := os.Stat(archivo.Name + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("%q: Abort dejó el temporal: %v", compresion, err)
+		}
+	}
+
+	if _, err := createBackupFile(filepath.Join(dir, "x.sql"), "lz4"); err == nil {
+		t.Error("se esperaba un error con una compresión no soportada")
+	}
+	entradas, _ := os.ReadDir(dir)
+	for _, entrada := range entradas {
+		if strings.HasPrefix(entrada.Name(), "x.sql") {
+			t.Errorf("quedó %s", entrada.Name())
+		}
+	}
+	if bytes.Contains([]byte(fila), []byte{0}) {
+		t.Error("el literal contiene un NUL sin escapar")
+	}
+}
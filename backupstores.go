@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// extensiones de los respaldos de bases sqlite3 y badgerdb, antes de la de compresión
+const (
+	sqliteBackupExt      = ".sqlite"
+	badgerFullExt        = ".full.badger"
+	badgerIncrementalExt = ".incr.badger"
+)
+
+const (
+	// páginas que se copian por paso en el respaldo de SQLite, entre pasos las
+	// escrituras de otras conexiones pueden avanzar
+	sqliteBackupPages = 1024
+	sqliteBackupPause = 10 * time.Millisecond
+
+	// escrituras pendientes al cargar un respaldo de badger
+	badgerLoadPendingWrites = 256
+)
+
+// backupSqlite copia la base con la API de respaldo de SQLite, que no bloquea
+// la base mientras se copia, y luego la escribe (comprimida o no) en dir
+func backupSqlite(ctx context.Context, base DataStore, dir, compresion string) error {
+	origen, err := GetPool("sqlite3", ReadOnlyDSN(base.Path))
+	if err != nil {
+		return err
+	}
+	conn, err := origen.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	temporal, err := os.CreateTemp(dir, ".sqlite-*")
+	if err != nil {
+		return fmt.Errorf("error creando archivo: %v", err)
+	}
+	temporal.Close()
+	defer os.Remove(temporal.Name())
+
+	destino, err := sql.Open(sqliteDriver, temporal.Name())
+	if err != nil {
+		return err
+	}
+	defer destino.Close()
+	dconn, err := destino.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	err = dconn.Raw(func(d any) error {
+		return conn.Raw(func(o any) error {
+			return copySqlite(ctx, d.(*sqlite3.SQLiteConn), o.(*sqlite3.SQLiteConn))
+		})
+	})
+	dconn.Close()
+	if err != nil {
+		return err
+	}
+	if err := destino.Close(); err != nil {
+		return err
+	}
+
+	archivo, err := os.Open(temporal.Name())
+	if err != nil {
+		return err
+	}
+	defer archivo.Close()
+	file, err := createBackupFile(backupName(dir, base.Name, time.Now())+sqliteBackupExt, compresion)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, archivo); err != nil {
+		file.Abort()
+		return fmt.Errorf("error escribiendo archivo: %v", err)
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Backup creado exitosamente: %s", file.Name)
+	return nil
+}
+
+// copySqlite copia la base main de origen en destino por pasos
+func copySqlite(ctx context.Context, destino, origen *sqlite3.SQLiteConn) error {
+	respaldo, err := destino.Backup("main", origen, "main")
+	if err != nil {
+		return fmt.Errorf("error iniciando respaldo: %v", err)
+	}
+	for {
+		listo, err := respaldo.Step(sqliteBackupPages)
+		if err != nil {
+			respaldo.Close()
+			return fmt.Errorf("error copiando la base: %v", err)
+		}
+		if listo {
+			return respaldo.Finish()
+		}
+		select {
+		case <-ctx.Done():
+			respaldo.Close()
+			return ctx.Err()
+		case <-time.After(sqliteBackupPause):
+		}
+	}
+}
+
+// badgerBackupState es el estado de los respaldos de una base badger, se
+// guarda en .<base>.json dentro de la carpeta de respaldos
+type badgerBackupState struct {
+	File         string `json:"file"`         // último respaldo
+	Version      uint64 `json:"version"`      // última versión respaldada, el próximo incremental sigue desde ahí
+	Incrementals int    `json:"incrementals"` // incrementales desde el último completo
+}
+
+func badgerStatePath(dir, base string) string {
+	return filepath.Join(dir, "."+base+".json")
+}
+
+// ctxWriter falla al cancelarse ctx, así se interrumpe db.Backup que no recibe contexto
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c ctxWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// backupBadger escribe un respaldo con db.Backup. Es incremental (solo las
+// versiones posteriores al respaldo anterior) salvo que no haya un respaldo
+// completo previo, que el último respaldo ya no exista o que se hayan hecho
+// incrementales respaldos incrementales seguidos
+func backupBadger(ctx context.Context, base DataStore, dir, compresion string, incrementales int) error {
+	db, release, err := AcquireBadger(base.Path)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var estado badgerBackupState
+	completo := true
+	if datos, err := os.ReadFile(badgerStatePath(dir, base.Name)); err == nil && json.Unmarshal(datos, &estado) == nil {
+		completo = incrementales <= 0 || estado.Incrementals >= incrementales || !continuesChain(dir, base.Name, estado.File)
+	}
+	// la documentación de db.Backup dice que incluye las versiones mayores o
+	// iguales a desde, pero el iterador de badger v3 descarta las versiones
+	// menores o iguales a SinceTs: con la última versión respaldada el
+	// incremental no la repite, y con esa versión + 1 perdería la siguiente
+	extension, desde := badgerIncrementalExt, estado.Version
+	if completo {
+		extension, desde = badgerFullExt, 0
+	}
+
+	file, err := createBackupFile(backupName(dir, base.Name, time.Now())+extension, compresion)
+	if err != nil {
+		return err
+	}
+	version, err := db.Backup(ctxWriter{ctx: ctx, w: file}, desde)
+	if err != nil {
+		file.Abort()
+		return fmt.Errorf("error respaldando la base: %v", err)
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	nuevo := badgerBackupState{File: filepath.Base(file.Name), Version: desde, Incrementals: estado.Incrementals + 1}
+	if completo {
+		nuevo.Incrementals = 0
+	}
+	// db.Backup devuelve la versión de la última entrada respaldada, sin
+	// cambios devuelve 0 y el próximo incremental sigue desde la misma versión
+	if version > nuevo.Version {
+		nuevo.Version = version
+	}
+	datos, _ := json.Marshal(nuevo)
+	ruta := badgerStatePath(dir, base.Name)
+	if err := os.WriteFile(ruta+".tmp", datos, 0644); err != nil {
+		return fmt.Errorf("error guardando el estado del respaldo: %v", err)
+	}
+	if err := os.Rename(ruta+".tmp", ruta); err != nil {
+		return fmt.Errorf("error guardando el estado del respaldo: %v", err)
+	}
+	log.Printf("Backup creado exitosamente: %s", file.Name)
+	return nil
+}
+
+// continuesChain indica si un incremental puede seguir a ultimo: debe ser el
+// respaldo más reciente de base y su cadena debe empezar con un completo
+func continuesChain(dir, base, ultimo string) bool {
+	cadenas, err := badgerChains(dir, base)
+	if err != nil || len(cadenas) == 0 || !cadenas[0].Full {
+		return false
+	}
+	rutas := cadenas[0].Paths
+	return filepath.Base(rutas[len(rutas)-1]) == ultimo
+}
+
+// badgerChain es un respaldo completo de badger y los incrementales que le
+// siguen, en orden. Solo se puede restaurar completa, por eso la retención la
+// conserva o la borra entera según la fecha de su último respaldo
+type badgerChain struct {
+	Paths []string
+	Time  time.Time
+	Full  bool // empieza con un respaldo completo
+}
+
+// badgerChains devuelve las cadenas de respaldos de base, de la más nueva a la más vieja
+func badgerChains(dir, base string) ([]badgerChain, error) {
+	respaldos, err := listBackups(dir, base)
+	if err != nil {
+		return nil, err
+	}
+	var cadenas []badgerChain
+	for i := len(respaldos) - 1; i >= 0; i-- {
+		completo := strings.Contains(filepath.Base(respaldos[i].Path), badgerFullExt)
+		if completo || len(cadenas) == 0 {
+			cadenas = append(cadenas, badgerChain{Full: completo})
+		}
+		cadena := &cadenas[len(cadenas)-1]
+		cadena.Paths = append(cadena.Paths, respaldos[i].Path)
+		cadena.Time = respaldos[i].Time
+	}
+	for i, j := 0, len(cadenas)-1; i < j; i, j = i+1, j-1 {
+		cadenas[i], cadenas[j] = cadenas[j], cadenas[i]
+	}
+	return cadenas, nil
+}
+
+// PruneBadgerBackups aplica la política a las cadenas de respaldos de base en dir
+func PruneBadgerBackups(dir, base string, politica RetentionPolicy) ([]string, error) {
+	if !politica.Enabled() {
+		return nil, nil
+	}
+	cadenas, err := badgerChains(dir, base)
+	if err != nil {
+		return nil, err
+	}
+	fechas := make([]time.Time, len(cadenas))
+	for i, cadena := range cadenas {
+		fechas[i] = cadena.Time
+	}
+	var borrar []string
+	for i, conservar := range politica.Keep(fechas) {
+		if !conservar {
+			borrar = append(borrar, cadenas[i].Paths...)
+		}
+	}
+	return removeBackups(borrar)
+}
+
+// SnapshotType devuelve sqlite3 o badgerdb si ruta es un respaldo de esas
+// bases, o "" si es un respaldo SQL
+func SnapshotType(ruta string) string {
+	nombre := filepath.Base(ruta)
+	for _, extension := range compressionExtensions {
+		if extension != "" {
+			nombre = strings.TrimSuffix(nombre, extension)
+		}
+	}
+	switch {
+	case strings.HasSuffix(nombre, sqliteBackupExt):
+		return "sqlite3"
+	case strings.HasSuffix(nombre, badgerFullExt), strings.HasSuffix(nombre, badgerIncrementalExt):
+		return "badgerdb"
+	}
+	return ""
+}
+
+// RestoreSnapshot crea la base dbname a partir de un respaldo de SQLite o de
+// badger; de badger se cargan el completo y los incrementales hasta ruta
+func RestoreSnapshot(ctx context.Context, ruta, dbtype, dbname string) error {
+	if tipo := SnapshotType(ruta); tipo != dbtype {
+		return NewAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("el respaldo %s no es de una base %s", filepath.Base(ruta), dbtype))
+	}
+	destino, err := ResolveDbPath(dbname)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(destino); err == nil {
+		return NewAPIError(http.StatusConflict, CodeInvalidRequest, "la base ya existe, la restauración crea una base nueva")
+	}
+	temporal := destino + ".restore"
+	os.RemoveAll(temporal)
+	defer os.RemoveAll(temporal)
+
+	if dbtype == "sqlite3" {
+		if err := restoreSqliteSnapshot(ruta, temporal); err != nil {
+			return err
+		}
+		// Link falla si mientras tanto se creó una base con el mismo nombre
+		if err := os.Link(temporal, destino); err != nil {
+			return fmt.Errorf("error moviendo la base restaurada: %v", err)
+		}
+		return nil
+	}
+
+	rutas, err := badgerRestoreChain(ruta)
+	if err != nil {
+		return err
+	}
+	if err := restoreBadgerSnapshot(ctx, rutas, temporal); err != nil {
+		return err
+	}
+	if err := os.Rename(temporal, destino); err != nil {
+		return fmt.Errorf("error moviendo la base restaurada: %v", err)
+	}
+	return nil
+}
+
+func restoreSqliteSnapshot(ruta, temporal string) error {
+	r, _, cerrar, err := openBackupFile(ruta)
+	if err != nil {
+		return err
+	}
+	defer cerrar()
+	archivo, err := os.Create(temporal)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archivo, r)
+	if cerr := archivo.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error escribiendo la base restaurada: %v", err)
+	}
+	if !isSqliteFile(temporal) {
+		return fmt.Errorf("el respaldo %s no es una base SQLite", ruta)
+	}
+	return nil
+}
+
+// badgerRestoreChain devuelve el respaldo completo y los incrementales hasta ruta
+func badgerRestoreChain(ruta string) ([]string, error) {
+	dir, nombre := filepath.Split(ruta)
+	// <base>_<fecha y hora>.(full|incr).badger[.gz|.zst]
+	fin := strings.LastIndex(nombre, badgerFullExt)
+	if fin < 0 {
+		fin = strings.LastIndex(nombre, badgerIncrementalExt)
+	}
+	inicio := fin - len(backupTimeLayout) - 1
+	if inicio <= 0 || nombre[inicio] != '_' {
+		return nil, fmt.Errorf("nombre de respaldo '%s' inválido", nombre)
+	}
+	cadenas, err := badgerChains(filepath.Clean(dir), nombre[:inicio])
+	if err != nil {
+		return nil, err
+	}
+	for _, cadena := range cadenas {
+		for i, r := range cadena.Paths {
+			if filepath.Base(r) != nombre {
+				continue
+			}
+			if !cadena.Full {
+				return nil, fmt.Errorf("falta el respaldo completo anterior a %s", nombre)
+			}
+			return cadena.Paths[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("el respaldo '%s' no existe", nombre)
+}
+
+func restoreBadgerSnapshot(ctx context.Context, rutas []string, temporal string) error {
+	db, err := InitDB(temporal)
+	if err != nil {
+		return err
+	}
+	for _, ruta := range rutas {
+		if err := ctx.Err(); err != nil {
+			db.Close()
+			return err
+		}
+		r, _, cerrar, err := openBackupFile(ruta)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		err = db.Load(r, badgerLoadPendingWrites)
+		cerrar()
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("error cargando %s: %v", ruta, err)
+		}
+		log.Printf("Respaldo cargado: %s", ruta)
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("error cerrando la base restaurada: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestBadgerRestoreChain(t *testing.T) {
+	dir := t.TempDir()
+	for _, nombre := range []string{
+		"kv_2026-10-01_000000.incr.badger", // incremental sin completo anterior
+		"kv_2026-10-02_000000.full.badger",
+		"kv_2026-10-03_000000.incr.badger",
+		"kv_2026-10-04_000000.incr.badger.gz",
+		"kv_2026-10-05_000000.full.badger.zst",
+		"kv_2026-10-06_000000.incr.badger",
+		"kv_x_2026-10-03_000000.full.badger",
+		"otra_2026-10-02_000000.incr.badger",
+		"kv_2026-10-07_000000.incr.badger.tmp",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, nombre), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	casos := []struct {
+		nombre   string
+		esperado []string
+	}{
+		{"kv_2026-10-02_000000.full.badger", []string{"kv_2026-10-02_000000.full.badger"}},
+		{"kv_2026-10-04_000000.incr.badger.gz", []string{"kv_2026-10-02_000000.full.badger", "kv_2026-10-03_000000.incr.badger", "kv_2026-10-04_000000.incr.badger.gz"}},
+		{"kv_2026-10-06_000000.incr.badger", []string{"kv_2026-10-05_000000.full.badger.zst", "kv_2026-10-06_000000.incr.badger"}},
+		{"kv_x_2026-10-03_000000.full.badger", []string{"kv_x_2026-10-03_000000.full.badger"}},
+		{"kv_2026-10-01_000000.incr.badger", nil}, // falta el completo
+		{"otra_2026-10-02_000000.incr.badger", nil},
+		{"kv_2026-10-07_000000.incr.badger", nil}, // no existe
+		{"kv.full.badger", nil},
+	}
+	for _, caso := range casos {
+		rutas, err := badgerRestoreChain(filepath.Join(dir, caso.nombre))
+		if caso.esperado == nil {
+			if err == nil {
+				t.Errorf("%s: se esperaba un error, obtenido %v", caso.nombre, rutas)
+			}
+			continue
+		}
+		var nombres []string
+		for _, ruta := range rutas {
+			nombres = append(nombres, filepath.Base(ruta))
+		}
+		if err != nil || !reflect.DeepEqual(nombres, caso.esperado) {
+			t.Errorf("%s: obtenido %v %v, esperado %v", caso.nombre, nombres, err, caso.esperado)
+		}
+	}
+
+	continua := []struct {
+		base, ultimo string
+		esperado     bool
+	}{
+		{"kv", "kv_2026-10-06_000000.incr.badger", true},
+		{"kv", "kv_2026-10-05_000000.full.badger.zst", false}, // hay un respaldo posterior
+		{"kv", "", false},
+		{"kv_x", "kv_x_2026-10-03_000000.full.badger", true},
+		{"otra", "otra_2026-10-02_000000.incr.badger", false}, // la cadena no empieza con un completo
+		{"nueva", "", false},
+	}
+	for _, caso := range continua {
+		if obtenido := continuesChain(dir, caso.base, caso.ultimo); obtenido != caso.esperado {
+			t.Errorf("continuesChain(%s, %q): obtenido %v, esperado %v", caso.base, caso.ultimo, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestBackupBadgerIncremental(t *testing.T) {
+	ctx := context.Background()
+	datos, respaldos := t.TempDir(), t.TempDir()
+	base := DataStore{Name: "kv", Path: filepath.Join(datos, "kv"), DbType: "badgerdb"}
+	t.Cleanup(func() { badgers.closeIdle(0) })
+
+	escribir := func(clave, valor string) {
+		t.Helper()
+		db, release, err := AcquireBadger(base.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		if err := db.Update(func(txn *badger.Txn) error { return txn.Set([]byte(clave), []byte(valor)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// los nombres de los respaldos tienen resolución de un segundo
+	respaldar := func() string {
+		t.Helper()
+		time.Sleep(1100 * time.Millisecond)
+		if err := backupBadger(ctx, base, respaldos, CompressionNone, 5); err != nil {
+			t.Fatal(err)
+		}
+		lista, err := listBackups(respaldos, base.Name)
+		if err != nil || len(lista) == 0 {
+			t.Fatal(lista, err)
+		}
+		return lista[0].Path
+	}
+	tamanio := func(ruta string) int64 {
+		info, err := os.Stat(ruta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	escribir("a", "1")
+	completo := respaldar()
+	if SnapshotType(completo) != "badgerdb" || filepath.Ext(filepath.Base(completo[:len(completo)-len(".badger")])) != ".full" {
+		t.Fatalf("se esperaba un respaldo completo, obtenido %s", completo)
+	}
+	// sin cambios el incremental queda vacío
+	if vacio := respaldar(); tamanio(vacio) != 0 {
+		t.Errorf("incremental sin cambios de %d bytes: %s", tamanio(vacio), vacio)
+	}
+	escribir("b", "2")
+	ultimo := respaldar()
+	if tamanio(ultimo) == 0 {
+		t.Errorf("el incremental no incluye la clave nueva: %s", ultimo)
+	}
+
+	rutas, err := badgerRestoreChain(ultimo)
+	if err != nil || len(rutas) != 3 || rutas[0] != completo {
+		t.Fatalf("cadena %v %v", rutas, err)
+	}
+	destino := filepath.Join(t.TempDir(), "restaurada")
+	if err := restoreBadgerSnapshot(ctx, rutas, destino); err != nil {
+		t.Fatal(err)
+	}
+	db, err := InitDB(destino)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for clave, esperado := range map[string]string{"a": "1", "b": "2"} {
+		err := db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get([]byte(clave))
+			if err != nil {
+				return err
+			}
+			valor, err := item.ValueCopy(nil)
+			if err == nil && string(valor) != esperado {
+				t.Errorf("%s: obtenido %q, esperado %q", clave, valor, esperado)
+			}
+			return err
+		})
+		if err != nil {
+			t.Errorf("%s: %v", clave, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// badgerEntry guarda una base badger abierta y cuantas solicitudes la usan.
+// ready se cierra cuando termina de abrirse, con err si no se pudo abrir
+type badgerEntry struct {
+	db       *badger.DB
+	err      error
+	ready    chan struct{}
+	inUse    int
+	lastUsed time.Time
+}
+
+type BadgerRegistry struct {
+	mu          sync.Mutex
+	stores      map[string]*badgerEntry
+	idleTimeout time.Duration
+	stop        chan struct{}
+	closed      bool
+	released    *sync.Cond // avisa cada vez que una solicitud deja de usar una base
+}
+
+var badgers = NewBadgerRegistry(10 * time.Minute)
+
+func NewBadgerRegistry(idleTimeout time.Duration) *BadgerRegistry {
+	r := &BadgerRegistry{
+		stores:      make(map[string]*badgerEntry),
+		idleTimeout: idleTimeout,
+	}
+	r.released = sync.NewCond(&r.mu)
+	return r
+}
+
+// InitBadgers configura el tiempo de inactividad (en segundos) tras el cual
+// se cierra una base badger y arranca la limpieza periódica, 0 la desactiva
+func InitBadgers(conf map[string]string) {
+	badgers.mu.Lock()
+	if v, ok := conf["badgeridletimeout"]; ok {
+		badgers.idleTimeout = time.Duration(ParseInt(v)) * time.Second
+	}
+	timeout := badgers.idleTimeout
+	badgers.mu.Unlock()
+
+	if timeout > 0 {
+		badgers.startJanitor(timeout)
+	}
+}
+
+// Acquire abre la base la primera vez que se pide y la comparte con las
+// siguientes solicitudes, release debe llamarse al terminar de usarla. La
+// base se abre fuera del candado: mientras tanto las demás bases siguen
+// disponibles y quien pida la misma espera a que termine de abrirse
+func (r *BadgerRegistry) Acquire(path string) (*badger.DB, func(), error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, nil, NewAPIError(http.StatusServiceUnavailable, CodeDbUnavailable, "el servidor se está apagando")
+	}
+	entry, ok := r.stores[path]
+	if !ok {
+		entry = &badgerEntry{ready: make(chan struct{})}
+		r.stores[path] = entry
+	}
+	entry.inUse++
+	entry.lastUsed = time.Now()
+	r.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			entry.inUse--
+			entry.lastUsed = time.Now()
+			r.released.Broadcast()
+		})
+	}
+
+	if !ok {
+		db, err := InitDB(path)
+		r.mu.Lock()
+		entry.db, entry.err = db, err
+		if err != nil {
+			delete(r.stores, path)
+		}
+		close(entry.ready)
+		r.mu.Unlock()
+	}
+	<-entry.ready
+	if entry.err != nil {
+		release()
+		return nil, nil, entry.err
+	}
+	return entry.db, release, nil
+}
+
+// closeIdle cierra las bases que no se usan desde hace más de timeout
+func (r *BadgerRegistry) closeIdle(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for path, entry := range r.stores {
+		if entry.inUse > 0 || time.Since(entry.lastUsed) < timeout {
+			continue
+		}
+		if err := entry.db.Close(); err != nil {
+			fmt.Println("error cerrando base badger", path, err)
+		}
+		delete(r.stores, path)
+	}
+}
+
+func (r *BadgerRegistry) startJanitor(timeout time.Duration) {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.closeIdle(timeout)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// CloseAll detiene la limpieza, rechaza nuevas solicitudes y cierra todas las
+// bases, se usa al apagar el servidor. Espera hasta espera a que terminen las
+// solicitudes que usan una base; las que siguen en uso después no se cierran
+func (r *BadgerRegistry) CloseAll(espera time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+
+	// Cond no tiene espera con límite, el temporizador despierta a Wait
+	vencido := false
+	temporizador := time.AfterFunc(espera, func() {
+		r.mu.Lock()
+		vencido = true
+		r.mu.Unlock()
+		r.released.Broadcast()
+	})
+	defer temporizador.Stop()
+	for r.storesInUse() > 0 && !vencido {
+		r.released.Wait()
+	}
+
+	var firstErr error
+	for path, entry := range r.stores {
+		if entry.inUse > 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error cerrando base badger %s: sigue en uso", path)
+			}
+			continue
+		}
+		if err := entry.db.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error cerrando base badger %s: %v", path, err)
+		}
+		delete(r.stores, path)
+	}
+	return firstErr
+}
+
+// storesInUse cuenta las bases que alguna solicitud está usando, requiere r.mu
+func (r *BadgerRegistry) storesInUse() int {
+	n := 0
+	for _, entry := range r.stores {
+		if entry.inUse > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func AcquireBadger(path string) (*badger.DB, func(), error) {
+	return badgers.Acquire(path)
+}
+
+func CloseBadgers(espera time.Duration) error {
+	return badgers.CloseAll(espera)
+}
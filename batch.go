@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// BatchStatement es una sentencia dentro de una solicitud "batch",
+// en badgerdb querytype indica la operación y dbquery la clave
+type BatchStatement struct {
+	Querytype string `json:"querytype"`
+	Dbquery   string `json:"dbquery"`
+	Params    []any  `json:"params"`
+}
+
+// executeBatch ejecuta las sentencias en orden dentro de una transacción,
+// si alguna falla se revierten todas
+func executeBatch(ctx context.Context, db *sql.DB, dbtype string, sentencias []BatchStatement) ([]map[string]any, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resultados := make([]map[string]any, 0, len(sentencias))
+	for i, sentencia := range sentencias {
+		resultado, err := tx.ExecContext(ctx, sentencia.Dbquery, sentencia.Params...)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error en la sentencia %d: %w", i, err)
+		}
+		resultados = append(resultados, ExecResult(ctx, tx, dbtype, resultado))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return resultados, nil
+}
+
+func BatchExecute(ctx context.Context, dbName string, sentencias []BatchStatement) ([]map[string]any, error) {
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("sqlite3", WriterDSN(dbName))
+	if err != nil {
+		return nil, err
+	}
+	return executeBatch(ctx, db, "sqlite3", sentencias)
+}
+
+func BatchExecuteMysql(ctx context.Context, dsn string, sentencias []BatchStatement) ([]map[string]any, error) {
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return executeBatch(ctx, db, "mysql", sentencias)
+}
+
+// BatchKV aplica las operaciones en una sola transacción badger,
+// si alguna falla no se guarda ninguna
+func BatchKV(db *badger.DB, sentencias []BatchStatement) ([]map[string]any, error) {
+	resultados := make([]map[string]any, 0, len(sentencias))
+	err := db.Update(func(txn *badger.Txn) error {
+		for i, sentencia := range sentencias {
+			key := []byte(sentencia.Dbquery)
+			params := sentencia.Params
+			if params == nil {
+				params = make([]any, 0)
+			}
+			value, err := json.Marshal(params)
+			if err != nil {
+				return fmt.Errorf("error en la sentencia %d: %w", i, err)
+			}
+
+			switch sentencia.Querytype {
+			case "exec":
+				_, err = txn.Get(key)
+				if err == nil {
+					err = fmt.Errorf("la clave '%s' %w", sentencia.Dbquery, ErrKeyExists)
+				} else if err == badger.ErrKeyNotFound {
+					err = txn.Set(key, value)
+				}
+			case "update":
+				if _, err = txn.Get(key); err == nil {
+					err = txn.Set(key, value)
+				}
+			case "upsert":
+				err = txn.Set(key, value)
+			case "delete":
+				if _, err = txn.Get(key); err == nil {
+					err = txn.Delete(key)
+				}
+			default:
+				err = NewAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("querytype '%s' no permitido en un lote", sentencia.Querytype))
+			}
+			if err != nil {
+				return fmt.Errorf("error en la sentencia %d: %w", i, err)
+			}
+			resultados = append(resultados, map[string]any{"key": sentencia.Dbquery})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultados, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule es una expresión cron de cinco campos: minuto, hora, día del
+// mes, mes y día de la semana (0 o 7 es domingo). Cada campo acepta *, listas
+// (1,15), rangos (1-5), pasos (*/15, 8-18/2) y nombres (jan, mon)
+type CronSchedule struct {
+	minutos, horas, dias, meses, semana uint64 // bit i activo si el valor i coincide
+
+	// con ambos campos restringidos basta que coincida uno de los dos, como en cron
+	diaLibre, semanaLibre bool
+}
+
+// expresiones abreviadas
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	nombre   string
+	min, max int
+	nombres  map[string]int
+}
+
+var (
+	cronMinutos = cronField{nombre: "minuto", min: 0, max: 59}
+	cronHoras   = cronField{nombre: "hora", min: 0, max: 23}
+	cronDias    = cronField{nombre: "día del mes", min: 1, max: 31}
+	cronMeses   = cronField{nombre: "mes", min: 1, max: 12, nombres: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 se acepta como domingo y se convierte en 0
+	cronSemana = cronField{nombre: "día de la semana", min: 0, max: 7, nombres: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cuántos años se buscan hacia adelante en Next, una expresión como
+// "0 0 30 2 *" nunca coincide
+const cronMaxYears = 5
+
+// ParseCron interpreta una expresión cron de cinco campos o un alias (@daily, @hourly...)
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	campos := strings.Fields(expr)
+	if len(campos) != 5 {
+		return nil, fmt.Errorf("expresión cron '%s' inválida: se esperan 5 campos (minuto hora día mes día-de-la-semana)", expr)
+	}
+
+	s := &CronSchedule{}
+	var err error
+	if s.minutos, err = parseCronField(campos[0], cronMinutos); err != nil {
+		return nil, err
+	}
+	if s.horas, err = parseCronField(campos[1], cronHoras); err != nil {
+		return nil, err
+	}
+	if s.dias, err = parseCronField(campos[2], cronDias); err != nil {
+		return nil, err
+	}
+	if s.meses, err = parseCronField(campos[3], cronMeses); err != nil {
+		return nil, err
+	}
+	if s.semana, err = parseCronField(campos[4], cronSemana); err != nil {
+		return nil, err
+	}
+	if s.semana&(1<<7) != 0 {
+		s.semana = s.semana&^(1<<7) | 1
+	}
+	s.diaLibre = strings.HasPrefix(campos[2], "*")
+	s.semanaLibre = strings.HasPrefix(campos[4], "*")
+	return s, nil
+}
+
+// parseCronField devuelve los valores del campo como bits
+func parseCronField(campo string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, parte := range strings.Split(campo, ",") {
+		rango, paso := parte, 1
+		if i := strings.Index(parte, "/"); i >= 0 {
+			rango = parte[:i]
+			n, err := strconv.Atoi(parte[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("paso inválido en el campo %s: '%s'", f.nombre, parte)
+			}
+			paso = n
+		}
+
+		desde, hasta := f.min, f.max
+		switch {
+		case rango == "*":
+		case strings.Contains(rango, "-"):
+			limites := strings.SplitN(rango, "-", 2)
+			var err error
+			if desde, err = cronValue(limites[0], f); err != nil {
+				return 0, err
+			}
+			if hasta, err = cronValue(limites[1], f); err != nil {
+				return 0, err
+			}
+			if desde > hasta {
+				return 0, fmt.Errorf("rango inválido en el campo %s: '%s'", f.nombre, rango)
+			}
+		default:
+			var err error
+			if desde, err = cronValue(rango, f); err != nil {
+				return 0, err
+			}
+			// "5/15" equivale a "5-máximo/15"; sin paso es un solo valor
+			if paso == 1 {
+				hasta = desde
+			}
+		}
+		for v := desde; v <= hasta; v += paso {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// cronValue interpreta un número o un nombre dentro de los límites del campo
+func cronValue(valor string, f cronField) (int, error) {
+	if n, ok := f.nombres[strings.ToLower(valor)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(valor)
+	if err != nil {
+		return 0, fmt.Errorf("valor inválido en el campo %s: '%s'", f.nombre, valor)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("valor fuera de rango en el campo %s: %d (%d-%d)", f.nombre, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Next devuelve el primer minuto posterior a t que coincide con la expresión,
+// o el tiempo cero si no hay ninguno en los próximos años
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limite := t.AddDate(cronMaxYears, 0, 0)
+	for t.Before(limite) {
+		if s.meses&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.horas&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutos&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay aplica la regla de cron: si el día del mes y el de la semana están
+// restringidos basta con uno, si no deben coincidir los dos
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	dia := s.dias&(1<<uint(t.Day())) != 0
+	semana := s.semana&(1<<uint(t.Weekday())) != 0
+	if s.diaLibre || s.semanaLibre {
+		return dia && semana
+	}
+	return dia || semana
+}
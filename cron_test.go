@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-18 es domingo
+	fecha := func(anio int, mes time.Month, dia, hora, minuto int) time.Time {
+		return time.Date(anio, mes, dia, hora, minuto, 0, 0, time.UTC)
+	}
+	casos := []struct {
+		expresion string
+		desde     time.Time
+		esperado  time.Time
+	}{
+		{"0 * * * *", fecha(2026, 10, 18, 5, 30), fecha(2026, 10, 18, 6, 0)},
+		{"0 * * * *", fecha(2026, 10, 18, 6, 0), fecha(2026, 10, 18, 7, 0)},
+		{"*/15 * * * *", fecha(2026, 10, 18, 5, 7), fecha(2026, 10, 18, 5, 15)},
+		{"8-18/5 * * * *", fecha(2026, 10, 18, 5, 10), fecha(2026, 10, 18, 5, 13)},
+		{"5/20 * * * *", fecha(2026, 10, 18, 5, 30), fecha(2026, 10, 18, 5, 45)},
+		{"30 2 * * *", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 19, 2, 30)},
+		{"@daily", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 19, 0, 0)},
+		{"@monthly", fecha(2026, 12, 15, 0, 0), fecha(2027, 1, 1, 0, 0)},
+		// solo el día de la semana restringido
+		{"0 0 * * 1", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 19, 0, 0)},
+		{"0 0 * * 7", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 25, 0, 0)},
+		{"0 0 * * sun", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 25, 0, 0)},
+		// día del mes y de la semana restringidos: basta con uno
+		{"0 0 1 * 1", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 19, 0, 0)},
+		{"0 0 1 * 1", fecha(2026, 10, 26, 12, 0), fecha(2026, 11, 1, 0, 0)},
+		{"0 0 13 * 5", fecha(2026, 10, 18, 5, 0), fecha(2026, 10, 23, 0, 0)},
+		{"0 0 13 * 5", fecha(2026, 11, 7, 0, 0), fecha(2026, 11, 13, 0, 0)},
+		// un campo que empieza con * no cuenta como restringido: deben coincidir los dos
+		{"0 0 */2 * 1", fecha(2026, 10, 20, 0, 0), fecha(2026, 11, 9, 0, 0)},
+		{"0 12 * jan,jul mon-fri", fecha(2026, 10, 18, 5, 0), fecha(2027, 1, 1, 12, 0)},
+		{"0 0 29 2 *", fecha(2026, 10, 18, 5, 0), fecha(2028, 2, 29, 0, 0)},
+		{"59 23 31 12 *", fecha(2026, 12, 31, 23, 59), fecha(2027, 12, 31, 23, 59)},
+		{"0 0 30 2 *", fecha(2026, 10, 18, 5, 0), time.Time{}},
+	}
+	for _, caso := range casos {
+		horario, err := ParseCron(caso.expresion)
+		if err != nil {
+			t.Errorf("%q: %v", caso.expresion, err)
+			continue
+		}
+		if obtenido := horario.Next(caso.desde); !obtenido.Equal(caso.esperado) {
+			t.Errorf("%q desde %s: obtenido %s, esperado %s", caso.expresion, caso.desde, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expresion := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"@cada-hora",
+	} {
+		if _, err := ParseCron(expresion); err == nil {
+			t.Errorf("%q: se esperaba un error", expresion)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Nombres permitidos para bases sqlite3 y badgerdb: sin separadores de ruta ni ".."
+var dbNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// Nombres permitidos para bases MySQL: dbname se copia en el DSN, por eso no
+// puede llevar '?', '/', '&' ni otros caracteres que agreguen parámetros al driver
+var mysqlNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$][A-Za-z0-9_$-]{0,63}$`)
+
+// ValidateMysqlName valida el nombre de una base MySQL antes de armar el DSN
+func ValidateMysqlName(nombre string) error {
+	if !mysqlNamePattern.MatchString(nombre) {
+		return NewAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("dbname '%s' inválido, use solo letras, números, '_', '$' y '-'", nombre))
+	}
+	return nil
+}
+
+// DataDir limita los archivos sqlite3 y los directorios badgerdb a una carpeta
+type DataDir struct {
+	root        string
+	allowCreate bool
+	allowlist   map[string]struct{}
+}
+
+// carpeta de datos si dbsettings.json no define datadir; no puede ser el
+// directorio de trabajo, ahí están dbsettings.json, apikeys.json y queries.json
+const defaultDataDir = "data"
+
+var dataDir = &DataDir{root: defaultDataDir, allowCreate: true}
+
+// InitDataDir configura la carpeta de datos desde dbsettings.json:
+// datadir (carpeta raíz), allowcreate ("false" impide crear bases nuevas)
+// y databases (lista separada por comas de las bases permitidas)
+func InitDataDir(conf map[string]string) error {
+	root := conf["datadir"]
+	if root == "" {
+		root = defaultDataDir
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("error creando la carpeta de datos %s: %v", root, err)
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if resuelta, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resuelta
+	}
+
+	allowlist := make(map[string]struct{})
+	for _, nombre := range strings.Split(conf["databases"], ",") {
+		if nombre = strings.TrimSpace(nombre); nombre != "" {
+			allowlist[nombre] = struct{}{}
+		}
+	}
+
+	dataDir = &DataDir{
+		root:        abs,
+		allowCreate: conf["allowcreate"] != "false",
+		allowlist:   allowlist,
+	}
+	return nil
+}
+
+// Resolve valida el nombre enviado por el cliente y devuelve la ruta dentro de la carpeta de datos
+func (d *DataDir) Resolve(nombre string) (string, error) {
+	if !dbNamePattern.MatchString(nombre) || strings.Contains(nombre, "..") {
+		return "", NewAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("dbname '%s' inválido, use solo letras, números, '_', '-' y '.'", nombre))
+	}
+	if len(d.allowlist) > 0 && !In(d.allowlist, nombre) {
+		return "", NewAPIError(http.StatusForbidden, CodeDbAccessDenied, fmt.Sprintf("la base '%s' no está permitida", nombre))
+	}
+
+	ruta := filepath.Join(d.root, nombre)
+	info, err := os.Lstat(ruta)
+	if os.IsNotExist(err) {
+		if !d.allowCreate {
+			return "", NewAPIError(http.StatusNotFound, CodeDbNotFound, fmt.Sprintf("la base '%s' no existe", nombre))
+		}
+		return ruta, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// un enlace simbólico no puede apuntar fuera de la carpeta de datos
+	if info.Mode()&os.ModeSymlink != 0 {
+		destino, err := filepath.EvalSymlinks(ruta)
+		if err != nil {
+			return "", err
+		}
+		if destino != d.root && !strings.HasPrefix(destino, d.root+string(os.PathSeparator)) {
+			return "", NewAPIError(http.StatusForbidden, CodeDbAccessDenied, fmt.Sprintf("la base '%s' apunta fuera de la carpeta de datos", nombre))
+		}
+	}
+	return ruta, nil
+}
+
+func ResolveDbPath(nombre string) (string, error) {
+	return dataDir.Resolve(nombre)
+}
+
+// DataStore es una base sqlite3 o badgerdb existente en la carpeta de datos
+type DataStore struct {
+	Name   string
+	Path   string
+	DbType string // sqlite3 o badgerdb
+}
+
+// encabezado de todo archivo SQLite
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Stores devuelve las bases de la carpeta de datos (solo las de databases si
+// la lista no está vacía). Un directorio con MANIFEST es una base badger y un
+// archivo con el encabezado de SQLite una base sqlite3, el resto se ignora
+func (d *DataDir) Stores() ([]DataStore, error) {
+	entradas, err := os.ReadDir(d.root)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la carpeta de datos: %v", err)
+	}
+	var bases []DataStore
+	for _, entrada := range entradas {
+		nombre := entrada.Name()
+		// los archivos temporales de una restauración en curso
+		if strings.HasSuffix(nombre, ".restore") {
+			continue
+		}
+		// Resolve descarta los nombres inválidos, los que no están en databases
+		// y los enlaces que apuntan fuera de la carpeta
+		ruta, err := d.Resolve(nombre)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(ruta)
+		if err != nil {
+			continue
+		}
+		switch {
+		case info.IsDir():
+			if _, err := os.Stat(filepath.Join(ruta, "MANIFEST")); err == nil {
+				bases = append(bases, DataStore{Name: nombre, Path: ruta, DbType: "badgerdb"})
+			}
+		case info.Mode().IsRegular() && isSqliteFile(ruta):
+			bases = append(bases, DataStore{Name: nombre, Path: ruta, DbType: "sqlite3"})
+		}
+	}
+	return bases, nil
+}
+
+func isSqliteFile(ruta string) bool {
+	archivo, err := os.Open(ruta)
+	if err != nil {
+		return false
+	}
+	defer archivo.Close()
+	encabezado := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(archivo, encabezado); err != nil {
+		return false
+	}
+	return bytes.Equal(encabezado, sqliteHeader)
+}
+
+func ListStores() ([]DataStore, error) {
+	return dataDir.Stores()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDirResolve(t *testing.T) {
+	raiz, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuera := t.TempDir()
+	for _, archivo := range []string{filepath.Join(raiz, "ventas.db"), filepath.Join(fuera, "secreto.db")} {
+		if err := os.WriteFile(archivo, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(raiz, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	enlaces := map[string]string{
+		"interno.db":  filepath.Join(raiz, "ventas.db"),
+		"externo.db":  filepath.Join(fuera, "secreto.db"),
+		"relativo.db": "../" + filepath.Base(fuera) + "/secreto.db",
+		"carpeta":     fuera,
+		"raiz":        raiz,
+		"roto.db":     filepath.Join(raiz, "no-existe.db"),
+	}
+	for nombre, destino := range enlaces {
+		if err := os.Symlink(destino, filepath.Join(raiz, nombre)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	abierto := &DataDir{root: raiz, allowCreate: true}
+	cerrado := &DataDir{root: raiz, allowlist: map[string]struct{}{"ventas.db": {}, "externo.db": {}, "nueva.db": {}}}
+	casos := []struct {
+		dir    *DataDir
+		nombre string
+		codigo string // "" si se acepta
+	}{
+		{abierto, "ventas.db", ""},
+		{abierto, "nueva.db", ""},
+		{abierto, "kv_2026.badger", ""},
+		{abierto, "sub", ""},
+		{abierto, "interno.db", ""},
+		{abierto, "raiz", ""},
+		{abierto, "..", CodeInvalidRequest},
+		{abierto, "../secreto.db", CodeInvalidRequest},
+		{abierto, "a..b", CodeInvalidRequest},
+		{abierto, "sub/../ventas.db", CodeInvalidRequest},
+		{abierto, "sub/x.db", CodeInvalidRequest},
+		{abierto, `sub\x.db`, CodeInvalidRequest},
+		{abierto, filepath.Join(fuera, "secreto.db"), CodeInvalidRequest},
+		{abierto, ".oculta", CodeInvalidRequest},
+		{abierto, "", CodeInvalidRequest},
+		{abierto, "a\x00.db", CodeInvalidRequest},
+		{abierto, "externo.db", CodeDbAccessDenied},
+		{abierto, "relativo.db", CodeDbAccessDenied},
+		{abierto, "carpeta", CodeDbAccessDenied},
+		{cerrado, "ventas.db", ""},
+		{cerrado, "interno.db", CodeDbAccessDenied},
+		{cerrado, "externo.db", CodeDbAccessDenied}, // la lista no permite salir de la carpeta
+		{cerrado, "nueva.db", CodeDbNotFound},
+	}
+	for _, caso := range casos {
+		ruta, err := caso.dir.Resolve(caso.nombre)
+		if caso.codigo != "" {
+			if errorCode(err) != caso.codigo {
+				t.Errorf("%q: obtenido %q %v, esperado %s", caso.nombre, ruta, err, caso.codigo)
+			}
+			continue
+		}
+		if err != nil || ruta != filepath.Join(raiz, caso.nombre) {
+			t.Errorf("%q: obtenido %q %v", caso.nombre, ruta, err)
+		}
+	}
+	// un enlace roto no se puede seguir
+	if _, err := abierto.Resolve("roto.db"); err == nil {
+		t.Error("se esperaba un error con un enlace roto")
+	}
+}
+
+func TestValidateMysqlName(t *testing.T) {
+	for nombre, valido := range map[string]bool{
+		"ventas":            true,
+		"ventas_2026":       true,
+		"a$b-c":             true,
+		"":                  false,
+		"ventas?allowAll=1": false,
+		"ventas/otra":       false,
+		"ventas&x=1":        false,
+		"ventas.db":         false,
+		"ventas bis":        false,
+	} {
+		if err := ValidateMysqlName(nombre); (err == nil) != valido {
+			t.Errorf("%q: obtenido %v, esperado válido=%v", nombre, err, valido)
+		}
+	}
+}
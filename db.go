@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"regexp"
 
@@ -38,7 +37,7 @@ func InsertKV(db *badger.DB, key string, value []byte) error {
 		_, err := txn.Get([]byte(key))
 		if err == nil {
 			// La clave existe
-			return fmt.Errorf("la clave '%s' ya existe", key)
+			return fmt.Errorf("la clave '%s' %w", key, ErrKeyExists)
 		} else if err != badger.ErrKeyNotFound {
 			// Error diferente al de "clave no encontrada"
 			return err
@@ -62,10 +61,8 @@ func GetAllKeys(db *badger.DB) (map[string]any, error) {
 
 			// Obtener el valor de la clave
 			err := item.Value(func(val []byte) error {
-				// Agregar el par clave-valor al slice
-				var datos map[string]any
-				json.Unmarshal(val, &datos)
-				results[string(key)] = datos
+				// Agregar el par clave-valor al mapa
+				results[string(key)] = decodeKV(val)
 				return nil
 			})
 
@@ -82,6 +79,110 @@ func GetAllKeys(db *badger.DB) (map[string]any, error) {
 	return results, nil
 }
 
+// PageKV recorre las claves en orden y devuelve los pares como filas
+// {"key", "value"}. Con página empieza después del cursor, devuelve hasta Size
+// pares y el cursor de la página siguiente (vacío si no hay más); sin página
+// recorre todas. En find solo cuentan las claves que coinciden con la
+// expresión. Al alcanzar un límite de limites se deja de leer y se marca Truncated
+func PageKV(db *badger.DB, querytype, expresion string, pagina *PageRequest, limites Limits) (ResultSet, error) {
+	resultado := ResultSet{Names: []string{"key", "value"}, Rows: []map[string]any{}}
+	desde := ""
+	var err error
+	if pagina != nil {
+		if desde, err = pagina.KVStart(querytype, expresion); err != nil {
+			return resultado, err
+		}
+	}
+	var re *regexp.Regexp
+	if querytype == "find" {
+		if re, err = regexp.Compile(expresion); err != nil {
+			return resultado, err
+		}
+	}
+
+	limitador := rowLimiter{limites: limites}
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = pagina != nil && pagina.Desc
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Seek se ubica en la clave del cursor (o la anterior en orden inverso)
+		ultima := ""
+		if desde == "" {
+			it.Rewind()
+		} else {
+			it.Seek([]byte(desde))
+		}
+		for ; it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			if desde != "" && key == desde {
+				continue
+			}
+			if re != nil && !re.MatchString(key) {
+				continue
+			}
+			if pagina != nil && len(resultado.Rows) == pagina.Size {
+				resultado.Next = pagina.KVCursor(querytype, expresion, ultima)
+				return nil
+			}
+			// el valor guardado es JSON, su tamaño sirve de estimación sin leerlo
+			if !limitador.Allow(int64(len(key)) + item.ValueSize() + 17) {
+				resultado.Truncated = limitador.Truncated
+				if pagina != nil && ultima != "" {
+					resultado.Next = pagina.KVCursor(querytype, expresion, ultima)
+				}
+				return nil
+			}
+			err := item.Value(func(val []byte) error {
+				resultado.Rows = append(resultado.Rows, map[string]any{"key": key, "value": decodeKV(val)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ultima = key
+		}
+		return nil
+	})
+	return resultado, err
+}
+
+// FindKV devuelve los pares cuya clave coincide con la expresión regular, con
+// la misma página y límites que PageKV
+func FindKV(db *badger.DB, expresion string, pagina *PageRequest, limites Limits) (ResultSet, error) {
+	return PageKV(db, "find", expresion, pagina, limites)
+}
+
+// Find filtra un mapa por las claves que coinciden con una expresión regular
+func Find[V any](mapa map[string]V, expresion string) (map[string]V, error) {
+	// Compilar la expresión regular y manejar el posible error
+	re, err := regexp.Compile(expresion)
+	if err != nil {
+		return nil, err // Devolver el error si la expresión es inválida
+	}
+
+	// Crear un nuevo mapa para almacenar los resultados
+	resultados := make(map[string]V)
+	for clave, valor := range mapa {
+		if re.MatchString(clave) {
+			resultados[clave] = valor
+		}
+	}
+	return resultados, nil
+}
+
+// decodeKV decodifica un valor guardado, los valores no JSON se devuelven como
+// texto y los números se mantienen como json.Number para no perder precisión
+func decodeKV(val []byte) any {
+	var datos any
+	if err := decodeJSON(val, &datos); err != nil {
+		return string(val)
+	}
+	return datos
+}
+
 // Leer
 func SelectKV(db *badger.DB, key string) ([]byte, error) {
 	var value []byte
@@ -110,26 +211,21 @@ func UpdateKV(db *badger.DB, key string, newValue []byte) error {
 	})
 }
 
-// Eliminar
-func DeleteVK(db *badger.DB, key string) error {
+// Insertar o actualizar
+func UpsertKV(db *badger.DB, key string, value []byte) error {
 	return db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(key))
+		return txn.Set([]byte(key), value)
 	})
 }
 
-func Find(mapa map[string]string, expresion string) (map[string]string, error) {
-	// Compilar la expresión regular y manejar el posible error
-	re, err := regexp.Compile(expresion)
-	if err != nil {
-		return nil, err // Devolver el error si la expresión es inválida
-	}
-
-	// Crear un nuevo mapa para almacenar los resultados
-	resultados := make(map[string]string)
-	for clave, valor := range mapa {
-		if re.MatchString(clave) {
-			resultados[clave] = valor
+// Eliminar
+func DeleteVK(db *badger.DB, key string) error {
+	return db.Update(func(txn *badger.Txn) error {
+		// Verifica si la clave existe antes de eliminar
+		_, err := txn.Get([]byte(key))
+		if err != nil {
+			return err // Retorna error si la clave no existe
 		}
-	}
-	return resultados, nil
+		return txn.Delete([]byte(key))
+	})
 }
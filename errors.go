@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Códigos de error estables para que los clientes no dependan del mensaje
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeAuthInvalidKey = "AUTH_INVALID_KEY"
+	CodeAuthKeyExpired = "AUTH_KEY_EXPIRED"
+	CodeAuthForbidden  = "AUTH_FORBIDDEN"
+	CodeAuthSignature  = "AUTH_INVALID_SIGNATURE"
+	CodeAuthStale      = "AUTH_STALE_REQUEST"
+	CodeAuthReplay     = "AUTH_REPLAY"
+
+	CodeQuerytypeMismatch = "QUERYTYPE_MISMATCH"
+	CodeQueryForbidden    = "QUERY_FORBIDDEN"
+	CodeMultiStatement    = "MULTI_STATEMENT_NOT_ALLOWED"
+	CodeQueryTimeout      = "QUERY_TIMEOUT"
+	CodeQueryCanceled     = "QUERY_CANCELED"
+
+	CodeDbConstraint   = "DB_CONSTRAINT"
+	CodeDbSyntax       = "DB_SYNTAX"
+	CodeDbNotFound     = "DB_NOT_FOUND"
+	CodeDbAccessDenied = "DB_ACCESS_DENIED"
+	CodeDbLocked       = "DB_LOCKED"
+	CodeDbUnavailable  = "DB_UNAVAILABLE"
+	CodeDbError        = "DB_ERROR"
+	CodeKvNotFound     = "KV_NOT_FOUND"
+	CodeKvExists       = "KV_EXISTS"
+	CodeKvConflict     = "KV_CONFLICT"
+	CodeKvTooBig       = "KV_TXN_TOO_BIG"
+	CodeKvError        = "KV_ERROR"
+)
+
+// ErrKeyExists se devuelve al insertar una clave badger que ya existe
+var ErrKeyExists = errors.New("ya existe")
+
+// APIError es un error con su estado HTTP y código definidos
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// ClassifyError traduce los errores de MySQL, SQLite y Badger a un estado HTTP y un código
+func ClassifyError(err error) (int, string) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status, apiErr.Code
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return classifyMysql(mysqlErr)
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return classifySqlite(sqliteErr)
+	}
+
+	var regexErr *syntax.Error
+	if errors.As(err, &regexErr) {
+		return http.StatusBadRequest, CodeInvalidRequest
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeQueryTimeout
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return http.StatusNotFound, CodeKvNotFound
+	case errors.Is(err, ErrKeyExists):
+		return http.StatusConflict, CodeKvExists
+	case errors.Is(err, badger.ErrConflict):
+		return http.StatusConflict, CodeKvConflict
+	case errors.Is(err, badger.ErrTxnTooBig):
+		return http.StatusRequestEntityTooLarge, CodeKvTooBig
+	case errors.Is(err, badger.ErrEmptyKey), errors.Is(err, badger.ErrInvalidKey):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, CodeDbNotFound
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn):
+		return http.StatusServiceUnavailable, CodeDbUnavailable
+	}
+
+	var netErr *net.OpError
+	if errors.As(err, &netErr) {
+		return http.StatusServiceUnavailable, CodeDbUnavailable
+	}
+	return http.StatusInternalServerError, CodeDbError
+}
+
+func classifyMysql(err *mysql.MySQLError) (int, string) {
+	switch err.Number {
+	case 1062, 1048, 1451, 1452, 1216, 1217, 3819, 1364:
+		// duplicado, nulo, llave foránea, check y campo sin valor por defecto
+		return http.StatusConflict, CodeDbConstraint
+	case 1064, 1054, 1136, 1149:
+		// sintaxis, columna desconocida y número de columnas
+		return http.StatusBadRequest, CodeDbSyntax
+	case 1146, 1049, 1051:
+		// tabla o base de datos inexistente
+		return http.StatusNotFound, CodeDbNotFound
+	case 1044, 1045, 1142, 1143, 1227:
+		return http.StatusForbidden, CodeDbAccessDenied
+	case 1205, 1213:
+		// tiempo de espera de bloqueo e interbloqueo
+		return http.StatusConflict, CodeDbLocked
+	case 1040, 1203:
+		// demasiadas conexiones
+		return http.StatusServiceUnavailable, CodeDbUnavailable
+	}
+	return http.StatusInternalServerError, CodeDbError
+}
+
+func classifySqlite(err sqlite3.Error) (int, string) {
+	switch err.Code {
+	case sqlite3.ErrConstraint:
+		return http.StatusConflict, CodeDbConstraint
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return http.StatusServiceUnavailable, CodeDbLocked
+	case sqlite3.ErrReadonly, sqlite3.ErrPerm, sqlite3.ErrAuth:
+		return http.StatusForbidden, CodeDbAccessDenied
+	case sqlite3.ErrCantOpen, sqlite3.ErrNotADB:
+		return http.StatusNotFound, CodeDbNotFound
+	case sqlite3.ErrError:
+		// SQLite usa el mismo código para sintaxis y objetos inexistentes
+		mensaje := err.Error()
+		if strings.Contains(mensaje, "no such table") || strings.Contains(mensaje, "no such view") {
+			return http.StatusNotFound, CodeDbNotFound
+		}
+		return http.StatusBadRequest, CodeDbSyntax
+	}
+	return http.StatusInternalServerError, CodeDbError
+}
+
+// RespondError responde con el estado y el código que correspondan al error
+func RespondError(c *gin.Context, err error) {
+	err = contextError(c.Request.Context(), err)
+	status, code := ClassifyError(err)
+	c.Error(err)
+	c.JSON(status, gin.H{"status": "error", "code": code, "message": err.Error()})
+}
+
+// contextError reemplaza el error que devuelve el driver al cancelarse la
+// consulta (por ejemplo "interrupted" en SQLite) cuando venció el tiempo máximo
+// o se canceló la solicitud al apagar el servidor. Si el cliente se desconectó
+// el error se mantiene
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return NewAPIError(http.StatusGatewayTimeout, CodeQueryTimeout, "la consulta superó el tiempo máximo permitido")
+	case errors.Is(context.Cause(ctx), errShuttingDown):
+		return NewAPIError(http.StatusServiceUnavailable, CodeQueryCanceled, "la consulta se canceló porque el servidor se está apagando")
+	}
+	return err
+}
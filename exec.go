@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+)
+
+// rowQueryer es un *sql.Conn o un *sql.Tx, ambos trabajan sobre una sola conexión
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Consultas de respaldo cuando el driver no soporta LastInsertId o RowsAffected
+var lastInsertIdQueries = map[string]string{
+	"mysql":   "SELECT LAST_INSERT_ID()",
+	"sqlite3": "SELECT last_insert_rowid()",
+}
+
+var rowsAffectedQueries = map[string]string{
+	"mysql":   "SELECT ROW_COUNT()",
+	"sqlite3": "SELECT changes()",
+}
+
+// ExecResult extrae el id insertado y las filas afectadas de un sql.Result,
+// si el driver no los soporta se consultan en la misma conexión y si
+// tampoco es posible se devuelven como null
+func ExecResult(ctx context.Context, q rowQueryer, dbtype string, resultado sql.Result) map[string]any {
+	dat := map[string]any{"lastInsertId": nil, "rowsAffected": nil}
+
+	if id, err := resultado.LastInsertId(); err == nil {
+		dat["lastInsertId"] = id
+	} else if consulta, ok := lastInsertIdQueries[dbtype]; ok {
+		var id sql.NullInt64
+		if q.QueryRowContext(ctx, consulta).Scan(&id) == nil && id.Valid {
+			dat["lastInsertId"] = id.Int64
+		}
+	}
+
+	if filas, err := resultado.RowsAffected(); err == nil {
+		dat["rowsAffected"] = filas
+	} else if consulta, ok := rowsAffectedQueries[dbtype]; ok {
+		var filas sql.NullInt64
+		if q.QueryRowContext(ctx, consulta).Scan(&filas) == nil && filas.Valid {
+			dat["rowsAffected"] = filas.Int64
+		}
+	}
+	return dat
+}
+
+// ExecScript ejecuta una o varias sentencias separadas por ';' en una misma conexión.
+// Con varias sentencias los parámetros se reparten en orden según sus marcadores ?
+// y la respuesta incluye el resultado de cada una en "statements"
+func ExecScript(ctx context.Context, db *sql.DB, dbtype, script string, parametros ...any) (map[string]any, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sentencias := SplitStatements(script, dbtype == "mysql")
+	if len(sentencias) <= 1 {
+		resultado, err := conn.ExecContext(ctx, script, parametros...)
+		if err != nil {
+			return nil, err
+		}
+		return ExecResult(ctx, conn, dbtype, resultado), nil
+	}
+
+	total := 0
+	for _, sentencia := range sentencias {
+		total += sentencia.Placeholders
+	}
+	if len(parametros) > 0 && total != len(parametros) {
+		return nil, NewAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("el script tiene %d marcadores y se recibieron %d parámetros", total, len(parametros)))
+	}
+
+	// el script se aplica completo o no se aplica, salvo que maneje sus propias
+	// transacciones
+	var q execQueryer = conn
+	var tx *sql.Tx
+	if !managesTransaction(sentencias, dbtype == "mysql") {
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		q = tx
+	}
+
+	resultados := make([]map[string]any, 0, len(sentencias))
+	var filas int64
+	var ultimoId any
+	usados := 0
+	for i, sentencia := range sentencias {
+		var args []any
+		if len(parametros) > 0 {
+			args = parametros[usados : usados+sentencia.Placeholders]
+			usados += sentencia.Placeholders
+		}
+		resultado, err := q.ExecContext(ctx, sentencia.Text, args...)
+		if err != nil {
+			return nil, scriptError(dbtype, sentencias, i, tx != nil, err)
+		}
+		dat := ExecResult(ctx, q, dbtype, resultado)
+		if n, ok := dat["rowsAffected"].(int64); ok {
+			filas += n
+		}
+		ultimoId = dat["lastInsertId"]
+		resultados = append(resultados, dat)
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]any{
+		"lastInsertId": ultimoId,
+		"rowsAffected": filas,
+		"statements":   resultados,
+	}, nil
+}
+
+// execQueryer es un *sql.Conn o un *sql.Tx
+type execQueryer interface {
+	rowQueryer
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// sentencias de control de transacciones, un script que las usa no se envuelve
+// en otra transacción
+var transactionWords = map[string]bool{
+	"BEGIN": true, "START": true, "COMMIT": true, "ROLLBACK": true,
+	"SAVEPOINT": true, "RELEASE": true, "END": true,
+}
+
+func managesTransaction(sentencias []Statement, backslash bool) bool {
+	for _, sentencia := range sentencias {
+		if principales, _ := sqlWords(sentencia.Text, backslash); len(principales) > 0 && transactionWords[principales[0]] {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptError indica qué sentencia falló y si las anteriores se revirtieron.
+// En MySQL las sentencias DDL confirman implícitamente la transacción, si hubo
+// alguna hasta la que falló las anteriores pueden haber quedado aplicadas
+func scriptError(dbtype string, sentencias []Statement, fallo int, enTransaccion bool, err error) error {
+	aplicadas := !enTransaccion
+	if dbtype == "mysql" {
+		for _, sentencia := range sentencias[:fallo+1] {
+			if ClassifyStatement(sentencia.Text, true) == KindDDL {
+				aplicadas = true
+			}
+		}
+	}
+	detalle := "no se aplicó ninguna sentencia"
+	if aplicadas && fallo > 0 {
+		detalle = "las sentencias anteriores pueden haber quedado aplicadas"
+	}
+	return fmt.Errorf("error en la sentencia %d (%s), %s: %w", fallo, abbreviate(sentencias[fallo].Text), detalle, err)
+}
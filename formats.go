@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// Formatos de salida de los resultados de un select
+const (
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatMsgPack = "msgpack"
+)
+
+var formatContentTypes = map[string]string{
+	FormatJSON:    "application/json; charset=utf-8",
+	FormatCSV:     "text/csv; charset=utf-8",
+	FormatNDJSON:  "application/x-ndjson",
+	FormatMsgPack: "application/msgpack",
+}
+
+// tipos de la cabecera Accept reconocidos para cada formato
+var acceptFormats = map[string]string{
+	"text/csv":              FormatCSV,
+	"application/x-ndjson":  FormatNDJSON,
+	"application/msgpack":   FormatMsgPack,
+	"application/x-msgpack": FormatMsgPack,
+	"application/json":      FormatJSON,
+}
+
+// OutputFormat devuelve el formato pedido en el campo format o, si no se envió,
+// el primero reconocido de la cabecera Accept; por defecto json
+func OutputFormat(c *gin.Context, formato string) string {
+	if formato != "" {
+		return formato
+	}
+	for _, tipo := range strings.Split(c.GetHeader("Accept"), ",") {
+		tipo, _, _ = strings.Cut(strings.TrimSpace(tipo), ";")
+		if f, ok := acceptFormats[strings.ToLower(tipo)]; ok {
+			return f
+		}
+	}
+	return FormatJSON
+}
+
+// rowWriter escribe un resultado fila por fila en un formato de salida
+type rowWriter interface {
+	// Begin recibe los nombres de las columnas en orden y, con metadata, su descripción
+	Begin(columnas []string, info []ColumnInfo) error
+	Row(fila map[string]any) error
+	// End cierra el resultado con el estado final (success o error)
+	End(estado gin.H) error
+}
+
+// errStreamAborted indica que el formato no puede informar un error dentro del
+// cuerpo y que la respuesta debe cortarse para que el cliente la detecte incompleta
+var errStreamAborted = fmt.Errorf("respuesta interrumpida")
+
+func newRowWriter(formato string, w io.Writer) rowWriter {
+	switch formato {
+	case FormatCSV:
+		return &csvRowWriter{w: csv.NewWriter(w)}
+	case FormatNDJSON:
+		return &ndjsonRowWriter{enc: json.NewEncoder(w)}
+	case FormatMsgPack:
+		return &msgpackRowWriter{enc: codec.NewEncoder(w, &codec.MsgpackHandle{WriteExt: true})}
+	}
+	return &jsonRowWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+// jsonRowWriter escribe {"columns": [...], "data": [...], "rows": n, "status": ...}
+// con "status" al final para informar errores ocurridos después de las primeras filas
+type jsonRowWriter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	filas int
+}
+
+func (j *jsonRowWriter) Begin(columnas []string, info []ColumnInfo) error {
+	if info != nil {
+		if _, err := io.WriteString(j.w, `{"columns":`); err != nil {
+			return err
+		}
+		if err := j.enc.Encode(info); err != nil {
+			return err
+		}
+		_, err := io.WriteString(j.w, `,"data":[`)
+		return err
+	}
+	_, err := io.WriteString(j.w, `{"data":[`)
+	return err
+}
+
+func (j *jsonRowWriter) Row(fila map[string]any) error {
+	if j.filas > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.filas++
+	return j.enc.Encode(fila)
+}
+
+func (j *jsonRowWriter) End(estado gin.H) error {
+	if _, err := io.WriteString(j.w, "]"); err != nil {
+		return err
+	}
+	for _, clave := range []string{"rows", "next", "truncated", "truncatedBy", "code", "message", "status"} {
+		if valor, ok := estado[clave]; ok {
+			dat, _ := json.Marshal(valor)
+			if _, err := io.WriteString(j.w, `,"`+clave+`":`+string(dat)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(j.w, "}")
+	return err
+}
+
+// ndjsonRowWriter escribe una fila por línea, con metadata una primera línea
+// con las columnas y siempre una última línea con el estado
+type ndjsonRowWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonRowWriter) Begin(columnas []string, info []ColumnInfo) error {
+	if info != nil {
+		return n.enc.Encode(gin.H{"columns": info})
+	}
+	return nil
+}
+
+func (n *ndjsonRowWriter) Row(fila map[string]any) error {
+	return n.enc.Encode(fila)
+}
+
+func (n *ndjsonRowWriter) End(estado gin.H) error {
+	return n.enc.Encode(estado)
+}
+
+// msgpackRowWriter escribe una secuencia de objetos MessagePack con la misma
+// estructura que NDJSON: columnas (con metadata), una fila por objeto y estado
+type msgpackRowWriter struct {
+	enc *codec.Encoder
+}
+
+func (m *msgpackRowWriter) Begin(columnas []string, info []ColumnInfo) error {
+	if info != nil {
+		return m.enc.Encode(map[string]any{"columns": plainValue(info)})
+	}
+	return nil
+}
+
+func (m *msgpackRowWriter) Row(fila map[string]any) error {
+	return m.enc.Encode(plainValue(fila))
+}
+
+func (m *msgpackRowWriter) End(estado gin.H) error {
+	return m.enc.Encode(plainValue(map[string]any(estado)))
+}
+
+// csvRowWriter escribe una fila de cabecera con los nombres de las columnas.
+// CSV no tiene dónde informar un error ni un resultado truncado, en esos casos
+// la respuesta se corta
+type csvRowWriter struct {
+	w        *csv.Writer
+	columnas []string
+	registro []string
+}
+
+func (c *csvRowWriter) Begin(columnas []string, info []ColumnInfo) error {
+	c.columnas = columnas
+	c.registro = make([]string, len(columnas))
+	return c.w.Write(columnas)
+}
+
+func (c *csvRowWriter) Row(fila map[string]any) error {
+	for i, col := range c.columnas {
+		c.registro[i] = csvValue(fila[col])
+	}
+	if err := c.w.Write(c.registro); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) End(estado gin.H) error {
+	c.w.Flush()
+	if estado["status"] != "success" || estado["truncated"] == true {
+		return errStreamAborted
+	}
+	return c.w.Error()
+}
+
+// csvValue representa un valor como texto: NULL como campo vacío, fechas con el
+// formato de datetime y los objetos y arrays como JSON
+func csvValue(valor any) string {
+	switch v := valor.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.Number:
+		return v.String()
+	case json.RawMessage:
+		return string(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(datetimeLayout)
+	}
+	dat, err := json.Marshal(valor)
+	if err != nil {
+		return fmt.Sprint(valor)
+	}
+	return string(dat)
+}
+
+// plainValue prepara un valor para MessagePack: json.Number pasa a entero o a
+// float64 si no pierde precisión (si no, se mantiene como texto), el JSON crudo
+// se decodifica, las fechas pasan a texto y las estructuras a mapas
+func plainValue(valor any) any {
+	switch v := valor.(type) {
+	case json.Number:
+		texto := v.String()
+		if n, err := strconv.ParseInt(texto, 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(texto, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(texto, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == texto {
+			return f
+		}
+		return texto
+	case json.RawMessage:
+		var datos any
+		if decodeJSON(v, &datos) != nil {
+			return string(v)
+		}
+		return plainValue(datos)
+	case time.Time:
+		return v.Format(datetimeLayout)
+	case map[string]any:
+		mapa := make(map[string]any, len(v))
+		for clave, elemento := range v {
+			mapa[clave] = plainValue(elemento)
+		}
+		return mapa
+	case []any:
+		lista := make([]any, len(v))
+		for i, elemento := range v {
+			lista[i] = plainValue(elemento)
+		}
+		return lista
+	case []ColumnInfo:
+		lista := make([]any, len(v))
+		for i, col := range v {
+			info := map[string]any{"name": col.Name, "type": col.Type, "kind": col.Kind, "nullable": nil}
+			if col.Nullable != nil {
+				info["nullable"] = *col.Nullable
+			}
+			lista[i] = info
+		}
+		return lista
+	}
+	return valor
+}
+
+// RespondKV envía el resultado de un list o find de badgerdb (ver PageKV) en
+// el formato pedido. En json sin página se mantiene la respuesta habitual, un
+// objeto clave -> valor; con página data es la lista de {"key", "value"} en el
+// orden del recorrido, que en orden descendente un objeto no conserva
+func RespondKV(c *gin.Context, formato string, resultado ResultSet, pagina *PageRequest) {
+	if formato == FormatJSON && pagina == nil {
+		datos := make(map[string]any, len(resultado.Rows))
+		for _, fila := range resultado.Rows {
+			datos[fila["key"].(string)] = fila["value"]
+		}
+		respuesta := gin.H{"status": "success", "data": datos}
+		resultado.addTruncated(respuesta)
+		c.JSON(http.StatusOK, respuesta)
+		return
+	}
+	RespondRows(c, formato, resultado, SelectOptions{Page: pagina})
+}
@@ -42,7 +42,7 @@ func GinRouter() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // Permitir todos los orígenes
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Key-Id", "X-Timestamp", "X-Nonce", "X-Signature"},
 		AllowCredentials: true,
 	}))
 
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Limits son los límites de una consulta SQL, 0 indica sin límite
+type Limits struct {
+	MaxRows  int           // filas de un select
+	MaxBytes int64         // tamaño de las filas de la respuesta, ver rowLimiter
+	Timeout  time.Duration // duración de la consulta
+}
+
+var serverLimits = Limits{
+	MaxRows:  100000,
+	MaxBytes: 64 << 20,
+	Timeout:  30 * time.Second,
+}
+
+// InitLimits lee los límites del servidor desde dbsettings.json: maxrows,
+// maxresponsebytes y querytimeout (segundos)
+func InitLimits(conf map[string]string) {
+	if v, ok := conf["maxrows"]; ok {
+		serverLimits.MaxRows = int(ParseInt(v))
+	}
+	if v, ok := conf["maxresponsebytes"]; ok {
+		serverLimits.MaxBytes = ParseInt(v)
+	}
+	if v, ok := conf["querytimeout"]; ok {
+		serverLimits.Timeout = time.Duration(ParseInt(v)) * time.Second
+	}
+}
+
+// Limits devuelve los límites de la apikey, los valores que la clave no
+// define (0) se toman del servidor
+func (k *APIKey) Limits() Limits {
+	limites := serverLimits
+	if k.MaxRows > 0 {
+		limites.MaxRows = k.MaxRows
+	}
+	if k.MaxResponseBytes > 0 {
+		limites.MaxBytes = k.MaxResponseBytes
+	}
+	if k.QueryTimeout > 0 {
+		limites.Timeout = time.Duration(k.QueryTimeout) * time.Second
+	}
+	return limites
+}
+
+// WithTimeout aplica el tiempo máximo al contexto de la solicitud, al vencer
+// se cancelan QueryContext y ExecContext
+func (l Limits) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, l.Timeout)
+}
+
+// rowLimiter lleva la cuenta de filas y bytes de un resultado
+type rowLimiter struct {
+	limites   Limits
+	filas     int
+	bytes     int64
+	Truncated string // "maxrows" o "maxbytes" si el resultado se cortó
+}
+
+// Allow indica si la fila de tamaño bytes entra en el resultado, si no
+// marca el resultado como truncado. En streaming el tamaño no se conoce antes
+// de escribir la fila: se pasa 0 y los bytes escritos se suman con Add
+func (r *rowLimiter) Allow(bytes int64) bool {
+	if r.limites.MaxRows > 0 && r.filas >= r.limites.MaxRows {
+		r.Truncated = "maxrows"
+		return false
+	}
+	if r.limites.MaxBytes > 0 && r.bytes+bytes > r.limites.MaxBytes {
+		r.Truncated = "maxbytes"
+		return false
+	}
+	r.filas++
+	r.bytes += bytes
+	return true
+}
+
+// Add suma los bytes escritos de una fila ya aceptada por Allow
+func (r *rowLimiter) Add(bytes int64) {
+	r.bytes += bytes
+}
+
+// Size estima el tamaño de la fila en JSON sin codificarla, solo se calcula
+// si hay límite de bytes
+func (r *rowLimiter) Size(fila map[string]any) int64 {
+	if r.limites.MaxBytes <= 0 {
+		return 0
+	}
+	return jsonSize(fila)
+}
+
+// jsonSize estima el tamaño en JSON de un valor: cuenta el texto, los números y
+// la estructura pero no el escape de caracteres especiales
+func jsonSize(valor any) int64 {
+	switch v := valor.(type) {
+	case nil:
+		return 4
+	case string:
+		return int64(len(v)) + 2
+	case []byte:
+		return int64(len(v)) + 2
+	case json.Number:
+		return int64(len(v))
+	case json.RawMessage:
+		return int64(len(v))
+	case bool:
+		return 5
+	case int64:
+		return int64(len(strconv.AppendInt(nil, v, 10)))
+	case uint64:
+		return int64(len(strconv.AppendUint(nil, v, 10)))
+	case float64:
+		return int64(len(strconv.AppendFloat(nil, v, 'g', -1, 64)))
+	case time.Time:
+		return int64(len(datetimeLayout)) + 2
+	case map[string]any:
+		total := int64(2)
+		for clave, elemento := range v {
+			total += int64(len(clave)) + 4 + jsonSize(elemento)
+		}
+		return total
+	case []any:
+		total := int64(2)
+		for _, elemento := range v {
+			total += jsonSize(elemento) + 1
+		}
+		return total
+	}
+	return 16
+}
+
+// countingWriter cuenta los bytes escritos, StreamRows lo usa para medir las filas
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
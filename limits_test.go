@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRowLimiter(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		limites   Limits
+		tamanios  []int64
+		aceptadas int
+		truncado  string
+	}{
+		{"sin límites", Limits{}, []int64{10, 10, 10}, 3, ""},
+		{"filas", Limits{MaxRows: 2}, []int64{10, 10, 10}, 2, "maxrows"},
+		{"filas justas", Limits{MaxRows: 3}, []int64{10, 10, 10}, 3, ""},
+		{"bytes", Limits{MaxBytes: 25}, []int64{10, 10, 10}, 2, "maxbytes"},
+		{"bytes justos", Limits{MaxBytes: 30}, []int64{10, 10, 10}, 3, ""},
+		{"primera fila demasiado grande", Limits{MaxBytes: 5}, []int64{10}, 0, "maxbytes"},
+		{"primero el de filas", Limits{MaxRows: 1, MaxBytes: 5}, []int64{1, 10}, 1, "maxrows"},
+	}
+	for _, caso := range casos {
+		limitador := rowLimiter{limites: caso.limites}
+		aceptadas := 0
+		for _, tamanio := range caso.tamanios {
+			if !limitador.Allow(tamanio) {
+				break
+			}
+			aceptadas++
+		}
+		if aceptadas != caso.aceptadas || limitador.Truncated != caso.truncado {
+			t.Errorf("%s: aceptadas %d %q, esperado %d %q", caso.nombre, aceptadas, limitador.Truncated, caso.aceptadas, caso.truncado)
+		}
+	}
+
+	// en streaming los bytes se suman después de escribir la fila
+	limitador := rowLimiter{limites: Limits{MaxBytes: 20}}
+	for i := 0; i < 3; i++ {
+		if !limitador.Allow(0) {
+			t.Fatalf("fila %d rechazada antes de llegar al límite", i)
+		}
+		limitador.Add(10)
+	}
+	if limitador.Allow(0) || limitador.Truncated != "maxbytes" {
+		t.Error("se esperaba el corte por maxbytes después de escribir 30 bytes")
+	}
+}
+
+func TestJsonSize(t *testing.T) {
+	fila := map[string]any{"a": "x\"y", "b": json.Number("12.50"), "c": nil, "d": int64(-7), "e": []any{true, 1.5}}
+	codificada, _ := json.Marshal(fila)
+	// la estimación no cuenta los escapes, difiere en pocos bytes
+	if estimado := jsonSize(fila); estimado < int64(len(codificada))-2 || estimado > int64(len(codificada))+8 {
+		t.Errorf("estimado %d, codificado %d: %s", estimado, len(codificada), codificada)
+	}
+}
+
+func TestKeyLimits(t *testing.T) {
+	anterior := serverLimits
+	defer func() { serverLimits = anterior }()
+	InitLimits(map[string]string{"maxrows": "100", "maxresponsebytes": "1000", "querytimeout": "10"})
+
+	if l := (&APIKey{}).Limits(); l != (Limits{MaxRows: 100, MaxBytes: 1000, Timeout: 10 * time.Second}) {
+		t.Errorf("sin límites propios: %+v", l)
+	}
+	propia := &APIKey{MaxRows: 5, MaxResponseBytes: 50, QueryTimeout: 1}
+	if l := propia.Limits(); l != (Limits{MaxRows: 5, MaxBytes: 50, Timeout: time.Second}) {
+		t.Errorf("con límites propios: %+v", l)
+	}
+}
+
+func limitsTestDb(t *testing.T) string {
+	t.Helper()
+	ruta := filepath.Join(t.TempDir(), "limites.db")
+	db, err := sql.Open("sqlite3", ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, texto TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := db.Exec("INSERT INTO t VALUES (?, ?)", i, strings.Repeat("x", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ruta
+}
+
+func TestSelectLimits(t *testing.T) {
+	ruta := limitsTestDb(t)
+	ctx := context.Background()
+	casos := []struct {
+		nombre   string
+		limites  Limits
+		filas    int
+		truncado string
+	}{
+		{"sin límites", Limits{}, 10, ""},
+		{"maxrows", Limits{MaxRows: 3}, 3, "maxrows"},
+		{"maxrows igual al total", Limits{MaxRows: 10}, 10, ""},
+		{"maxbytes", Limits{MaxBytes: 450}, 3, "maxbytes"},
+	}
+	for _, caso := range casos {
+		resultado, err := SelectSqlite(ctx, ruta, "SELECT * FROM t ORDER BY id", SelectOptions{Limits: caso.limites})
+		if err != nil || len(resultado.Rows) != caso.filas || resultado.Truncated != caso.truncado {
+			t.Errorf("%s: %d filas %q %v, esperado %d %q", caso.nombre, len(resultado.Rows), resultado.Truncated, err, caso.filas, caso.truncado)
+		}
+	}
+
+	// con página el cursor sigue desde la última fila enviada
+	pagina := &PageRequest{Size: 5, Key: []string{"id"}}
+	var ids []int64
+	for i := 0; i < 10; i++ {
+		resultado, err := SelectSqlite(ctx, ruta, "SELECT * FROM t", SelectOptions{Page: pagina, Limits: Limits{MaxRows: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fila := range resultado.Rows {
+			ids = append(ids, fila["id"].(int64))
+		}
+		if resultado.Next == "" {
+			break
+		}
+		pagina.Cursor = resultado.Next
+	}
+	if len(ids) != 10 || ids[0] != 0 || ids[9] != 9 {
+		t.Errorf("páginas truncadas: %v", ids)
+	}
+}
+
+func TestSelectTimeout(t *testing.T) {
+	ruta := limitsTestDb(t)
+	ctx, cancel := Limits{Timeout: 100 * time.Millisecond}.WithTimeout(context.Background())
+	defer cancel()
+	inicio := time.Now()
+	_, err := SelectSqlite(ctx, ruta, "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n", SelectOptions{})
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("se esperaba que venciera la consulta: %v %v", err, ctx.Err())
+	}
+	if duracion := time.Since(inicio); duracion > 5*time.Second {
+		t.Errorf("la consulta no se canceló al vencer el tiempo: %s", duracion)
+	}
+}
+
+func TestStreamRowsLimits(t *testing.T) {
+	ruta := limitsTestDb(t)
+	gin.SetMode(gin.TestMode)
+	casos := []struct {
+		nombre   string
+		limites  Limits
+		filas    int
+		truncado string
+	}{
+		{"sin límites", Limits{}, 10, ""},
+		{"maxrows", Limits{MaxRows: 4}, 4, "maxrows"},
+		{"maxbytes", Limits{MaxBytes: 300}, 3, "maxbytes"},
+	}
+	for _, caso := range casos {
+		respuesta := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(respuesta)
+		c.Request = httptest.NewRequest("POST", "/", nil)
+		StreamRows(c, FormatNDJSON, "sqlite3", ruta, "SELECT * FROM t ORDER BY id", SelectOptions{Limits: caso.limites})
+
+		var lineas []map[string]any
+		lector := bufio.NewScanner(respuesta.Body)
+		for lector.Scan() {
+			var linea map[string]any
+			if err := json.Unmarshal(lector.Bytes(), &linea); err != nil {
+				t.Fatalf("%s: %v: %s", caso.nombre, err, lector.Text())
+			}
+			lineas = append(lineas, linea)
+		}
+		if len(lineas) != caso.filas+1 {
+			t.Errorf("%s: %d líneas, esperado %d filas y el estado", caso.nombre, len(lineas), caso.filas)
+			continue
+		}
+		estado := lineas[len(lineas)-1]
+		if truncado, _ := estado["truncatedBy"].(string); truncado != caso.truncado || estado["status"] != "success" {
+			t.Errorf("%s: estado %v", caso.nombre, estado)
+		}
+	}
+}
+
+func TestPageKVLimits(t *testing.T) {
+	db, err := InitDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error {
+		for _, clave := range []string{"a1", "a2", "a3", "b1", "b2"} {
+			if err := txn.Set([]byte(clave), []byte(`"`+strings.Repeat("v", 20)+`"`)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	casos := []struct {
+		querytype string
+		expresion string
+		limites   Limits
+		claves    string
+		truncado  string
+	}{
+		{"list", "", Limits{}, "a1 a2 a3 b1 b2", ""},
+		{"list", "", Limits{MaxRows: 2}, "a1 a2", "maxrows"},
+		{"list", "", Limits{MaxBytes: 100}, "a1 a2", "maxbytes"},
+		{"find", "^b", Limits{}, "b1 b2", ""},
+		{"find", "^a", Limits{MaxRows: 1}, "a1", "maxrows"},
+	}
+	for _, caso := range casos {
+		resultado, err := PageKV(db, caso.querytype, caso.expresion, nil, caso.limites)
+		var claves []string
+		for _, fila := range resultado.Rows {
+			claves = append(claves, fila["key"].(string))
+		}
+		if err != nil || strings.Join(claves, " ") != caso.claves || resultado.Truncated != caso.truncado {
+			t.Errorf("%s %q %+v: %v %q %v", caso.querytype, caso.expresion, caso.limites, claves, resultado.Truncated, err)
+		}
+	}
+
+	// con página el cursor sigue después de la última clave enviada
+	pagina := &PageRequest{Size: 3}
+	var claves []string
+	for i := 0; i < 5; i++ {
+		resultado, err := FindKV(db, "^[ab]", pagina, Limits{MaxRows: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fila := range resultado.Rows {
+			claves = append(claves, fila["key"].(string))
+		}
+		if resultado.Next == "" {
+			break
+		}
+		pagina.Cursor = resultado.Next
+	}
+	if strings.Join(claves, " ") != "a1 a2 a3 b1 b2" {
+		t.Errorf("páginas truncadas: %v", claves)
+	}
+}
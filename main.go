@@ -1,14 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -21,312 +22,156 @@ import (
 
 //var htmlContent embed.FS
 
-type Consulta struct {
-	DbType    string `json:"DbType"`
-	Dbname    string `json:"Dbname"`
-	Apikey    string `json:"Apikey"`
-	Querytype string `json:"Querytype"`
-	Dbquery   string `json:"Dbquery"`
-	Params    []any  `json:"Params"`
-}
-
-type BackupConfig struct {
-	User      string
-	Password  string
-	Host      string
-	Port      string
-	Database  string
-	BackupDir string
-}
-
 func PrintGreen(text ...string) {
 	fondoVerde := color.New(color.FgBlack, color.BgGreen)
 	resultado := strings.Join(text, " ")
 	fondoVerde.Println(resultado)
 }
 
-func getTables(db *sql.DB) ([]string, error) {
-	rows, err := db.Query("SHOW TABLES")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, err
+func main() {
+	// micro_db_server newkey <label> genera una apikey nueva en apikeys.json
+	if len(os.Args) > 1 && os.Args[1] == "newkey" {
+		label := "sin etiqueta"
+		if len(os.Args) > 2 {
+			label = os.Args[2]
 		}
-		tables = append(tables, table)
-	}
-	return tables, nil
-}
-
-func getCreateTable(db *sql.DB, table string) (string, error) {
-	var tableCreate string
-	err := db.QueryRow("SHOW CREATE TABLE "+table).Scan(&table, &tableCreate)
-	if err != nil {
-		return "", err
-	}
-	return tableCreate + ";\n", nil
-}
-
-func hasRows(db *sql.DB, table string) (bool, error) {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
-
-func dumpTable(db *sql.DB, table string, file *os.File) error {
-	// Obtener estructura de la tabla
-	create, err := getCreateTable(db, table)
-	if err != nil {
-		return err
-	}
-	file.WriteString("\n-- Estructura de tabla: " + table + "\n")
-	file.WriteString("DROP TABLE IF EXISTS `" + table + "`;\n")
-	file.WriteString(create)
-
-	// Verificar si la tabla tiene registros
-	hasData, err := hasRows(db, table)
-	if err != nil {
-		return err
-	}
-
-	if !hasData {
-		return nil // Salir si no hay datos
-	}
-
-	// Obtener datos
-	rows, err := db.Query("SELECT * FROM " + table)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return err
-	}
-
-	// Preparar buffer para los datos
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range columns {
-		valuePtrs[i] = &values[i]
-	}
-
-	file.WriteString("\n-- Datos de tabla: " + table + "\n")
-	file.WriteString("INSERT INTO `" + table + "` VALUES\n")
-
-	var rowCount int
-	for rows.Next() {
-		err := rows.Scan(valuePtrs...)
+		maestro, err := LoadSigningKey(signingKeyFile)
 		if err != nil {
-			return err
-		}
-
-		if rowCount > 0 {
-			file.WriteString(",\n")
+			log.Fatal(err)
 		}
-
-		// Construir valores de inserción
-		var rowValues []string
-		for _, val := range values {
-			if val == nil {
-				rowValues = append(rowValues, "NULL")
-			} else {
-				switch v := val.(type) {
-				case []byte:
-					rowValues = append(rowValues, fmt.Sprintf("'%s'", strings.ReplaceAll(string(v), "'", "\\'")))
-				case string:
-					rowValues = append(rowValues, fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "\\'")))
-				case time.Time:
-					rowValues = append(rowValues, fmt.Sprintf("'%s'", v.Format("2006-01-02 15:04:05")))
-				default:
-					rowValues = append(rowValues, fmt.Sprintf("%v", v))
-				}
-			}
+		clave, id, err := NewKey(keyStoreFile, label)
+		if err != nil {
+			log.Fatal(err)
 		}
-		file.WriteString("(" + strings.Join(rowValues, ",") + ")")
-		rowCount++
-	}
-	if rowCount > 0 {
-		file.WriteString(";\n")
-	}
-	return nil
-}
-
-func createBackup(config BackupConfig) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.Database,
-	)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return fmt.Errorf("error conectando a la base de datos: %v", err)
-	}
-	defer db.Close()
-
-	// Verificar conexión
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("error verificando conexión: %v", err)
-	}
-
-	// Crear archivo de backup
-	timestamp := time.Now().Format("2006-01-02")
-	filename := filepath.Join(config.BackupDir, fmt.Sprintf("%s_%s.sql", config.Database, timestamp))
-
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("error creando archivo: %v", err)
+		fmt.Println("Nueva apikey (guárdela, no se volverá a mostrar):", clave)
+		fmt.Println("Key id para solicitudes firmadas:", id)
+		fmt.Println("Secreto de firma (no se volverá a mostrar):", SigningSecret(maestro, id))
+		return
 	}
-	defer file.Close()
-
-	// Escribir encabezado
-	file.WriteString(fmt.Sprintf("-- Backup de %s\n", config.Database))
-	file.WriteString(fmt.Sprintf("-- Fecha: %s\n\n", timestamp))
-	file.WriteString(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;\n", config.Database))
-	file.WriteString(fmt.Sprintf("USE `%s`;\n\n", config.Database))
 
-	// Obtener lista de tablas
-	tables, err := getTables(db)
-	if err != nil {
-		return fmt.Errorf("error obteniendo tablas: %v", err)
+	CreateConfig()
+	//ExtractEmbeddedFiles()
+	confs, _ := LoadConfs()
+	if err := InitDataDir(confs); err != nil {
+		log.Fatal(err)
 	}
 
-	// Respaldar cada tabla
-	for _, table := range tables {
-		if err := dumpTable(db, table, file); err != nil {
-			return fmt.Errorf("error respaldando tabla %s: %v", table, err)
+	// micro_db_server restore [-dry-run] [-continue] <archivo> <mysql|sqlite3|badgerdb> <dbname>
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := RunRestoreCommand(os.Args[2:], confs); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Println("Respaldo de: ", table)
-	}
-
-	log.Printf("Backup creado exitosamente: %s", filename)
-	PrintGreen("BACKUP CREADO EXITOSAMENTE")
-	return nil
-}
-
-func respaldo(conf map[string]string) {
-	PrintGreen("Iniciando respaldo de base de datos en la carpeta static...")
-	config := BackupConfig{
-		User:      conf["dbuser"],
-		Password:  conf["dbpass"],
-		Host:      conf["dbhost"],
-		Port:      "3306",
-		Database:  conf["dbname"],
-		BackupDir: "static",
+		return
 	}
 
-	// Crear directorio si no existe
-	if err := os.MkdirAll(config.BackupDir, 0755); err != nil {
+	if err := InitPools(confs); err != nil {
 		log.Fatal(err)
 	}
-
-	// Ticker para ejecutar cada hora
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	// Primera ejecución inmediata
-	if err := createBackup(config); err != nil {
-		log.Printf("Error en backup: %v", err)
+	InitBadgers(confs)
+	InitLimits(confs)
+	keys, err := LoadKeyStore(keyStoreFile, confs)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Loop principal
-	for range ticker.C {
-		if err := createBackup(config); err != nil {
-			log.Printf("Error en backup: %v", err)
-		}
+	maestro, err := LoadSigningKey(signingKeyFile)
+	if err != nil {
+		log.Fatal(err)
 	}
-	PrintGreen("BACKUP CREADO EXITOSAMENTE")
-}
-
-func ejeBakup(conf map[string]string) {
-	//RespaldoJson()
-	respaldo(conf)
-	for {
-		time.Sleep(5 * time.Hour)
-		//RespaldoJson()
-		respaldo(conf)
+	InitBodyLimit(confs)
+	auth := NewAuthenticator(keys, maestro, confs)
+	catalog, err := NewQueryCatalog(queryCatalogFile)
+	if err != nil {
+		log.Fatal(err)
 	}
-}
-
-func main() {
-	CreateConfig()
-	//ExtractEmbeddedFiles()
-	confs, _ := LoadConfs()
 	//CreateTorrc(confs["port"], confs["tor"])
 	//go executeTor()
-	if confs["dbtype"] == "mysql" {
-		go ejeBakup(confs)
-	}
 	r := GinRouter()
+	srv := NewServer("0.0.0.0:"+confs["port"], r, time.Duration(ParseInt(confs["shutdowntimeout"]))*time.Second)
+	respaldos, err := NewBackupScheduler(confs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.Go(respaldos.Run)
+
+	r.POST("/admin/restore", RestoreHandler(auth, confs))
 
 	r.POST("/", func(c *gin.Context) {
-		var datos map[string]interface{}
-		if err := c.ShouldBindJSON(&datos); err != nil {
-			fmt.Println(err)
-			c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+		consulta, errores := DecodeConsulta(c)
+		if len(errores) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "code": CodeInvalidRequest, "message": "solicitud inválida", "errors": errores})
 			return
 		}
-		fmt.Println(datos)
-		if confs["apikey"] != datos["apikey"].(string) {
-			fmt.Println("apikey")
-			c.JSON(http.StatusOK, gin.H{"status": "error", "message": "invalid apikey"})
+		key, err := auth.Authenticate(c, consulta.Apikey)
+		if err != nil {
+			RespondError(c, err)
 			return
 		}
+		if errores := consulta.Prepare(catalog); len(errores) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "code": CodeInvalidRequest, "message": "solicitud inválida", "errors": errores})
+			return
+		}
+		if err := key.Authorize(consulta); err != nil {
+			RespondError(c, err)
+			return
+		}
+		if consulta.DbType == "sqlite3" || consulta.DbType == "mysql" {
+			allowMulti := key.MultiStatements || confs["allowmultistatements"] == "true"
+			if err := CheckStatements(consulta, allowMulti); err != nil {
+				RespondError(c, err)
+				return
+			}
+		}
 
-		if datos["dbtype"].(string) == "sqlite3" {
-			if datos["querytype"].(string) == "select" {
-				params := make([]any, 0)
-				if datos["params"] != nil {
-					params = datos["params"].([]any)
-				}
-				if len(params) > 0 {
-					dat, err := AssocSecure(datos["dbname"].(string), datos["dbquery"].(string), params...)
-					if err != nil {
-						c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
-						return
-					}
-					c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+		// el tiempo máximo cancela la consulta en curso, RespondError lo informa como QUERY_TIMEOUT
+		limites := key.Limits()
+		ctx, cancel := limites.WithTimeout(c.Request.Context())
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		if consulta.DbType == "sqlite3" {
+			dbPath, err := ResolveDbPath(consulta.Dbname)
+			if err != nil {
+				RespondError(c, err)
+				return
+			}
+			if consulta.Querytype == "select" {
+				formato := OutputFormat(c, consulta.Format)
+				opciones := SelectOptions{Metadata: consulta.Metadata, Page: consulta.Page, Limits: limites}
+				// csv, ndjson y msgpack se envían en streaming salvo al pedir una página
+				if consulta.Page == nil && (consulta.Stream || formato != FormatJSON) {
+					StreamRows(c, formato, "sqlite3", dbPath, consulta.Dbquery, opciones, consulta.Params...)
 					return
-				} else {
-					dat, err := Assoc(datos["dbname"].(string), datos["dbquery"].(string))
-					//fmt.Println(dat)
-					if err != nil {
-						c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
-						return
-					}
-					c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+				}
+				dat, err := SelectSqlite(ctx, dbPath, consulta.Dbquery, opciones, consulta.Params...)
+				if err != nil {
+					RespondError(c, err)
 					return
 				}
+				RespondRows(c, formato, dat, opciones)
+				return
 			}
-			if datos["querytype"].(string) == "exec" {
-				params := make([]any, 0)
-				if datos["params"] != nil {
-					params = datos["params"].([]any)
+			if consulta.Querytype == "exec" {
+				dat, err := Execute(ctx, dbPath, consulta.Dbquery, consulta.Params...)
+				if err != nil {
+					RespondError(c, err)
+					return
 				}
-				dat, err := Execute(datos["dbname"].(string), datos["dbquery"].(string), params...)
+				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+				return
+			}
+			if consulta.Querytype == "alter" {
+				dat, err := AlterTable(ctx, dbPath, consulta.Dbquery)
 				if err != nil {
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
 				return
 			}
-			if datos["querytype"].(string) == "alter" {
-				dat, err := AlterTable(datos["dbname"].(string), datos["dbquery"].(string))
+			if consulta.Querytype == "batch" {
+				dat, err := BatchExecute(ctx, dbPath, consulta.Statements)
 				if err != nil {
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
@@ -334,49 +179,50 @@ func main() {
 			}
 		}
 
-		if datos["dbtype"].(string) == "mysql" {
-			dns := Connection(confs["dbuser"], confs["dbpass"], confs["dbhost"], confs["dbport"], datos["dbname"].(string))
-			if datos["querytype"].(string) == "select" {
-				params := make([]any, 0)
-				if datos["params"] != nil {
-					params = datos["params"].([]any)
-				}
-				if len(params) > 0 {
-					dat, err := AssocSecureMysql(dns, datos["dbquery"].(string), params...)
-					if err != nil {
-						c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
-						return
-					}
-					c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+		if consulta.DbType == "mysql" {
+			if err := ValidateMysqlName(consulta.Dbname); err != nil {
+				RespondError(c, err)
+				return
+			}
+			dns := Connection(confs["dbuser"], confs["dbpass"], confs["dbhost"], confs["dbport"], consulta.Dbname)
+			if consulta.Querytype == "select" {
+				formato := OutputFormat(c, consulta.Format)
+				opciones := SelectOptions{Metadata: consulta.Metadata, Page: consulta.Page, Limits: limites}
+				// csv, ndjson y msgpack se envían en streaming salvo al pedir una página
+				if consulta.Page == nil && (consulta.Stream || formato != FormatJSON) {
+					StreamRows(c, formato, "mysql", dns, consulta.Dbquery, opciones, consulta.Params...)
 					return
-				} else {
-					dat, err := AssocMysql(dns, datos["dbquery"].(string))
-					if err != nil {
-						c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
-						return
-					}
-					c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+				}
+				dat, err := SelectMysql(ctx, dns, consulta.Dbquery, opciones, consulta.Params...)
+				if err != nil {
+					RespondError(c, err)
 					return
 				}
-
+				RespondRows(c, formato, dat, opciones)
+				return
 			}
-			if datos["querytype"].(string) == "exec" {
-				params := make([]any, 0)
-				if datos["params"] != nil {
-					params = datos["params"].([]any)
+			if consulta.Querytype == "exec" {
+				dat, err := ExecuteQueryMysql(ctx, dns, consulta.Dbquery, consulta.Params...)
+				if err != nil {
+					RespondError(c, err)
+					return
 				}
-				dat, err := ExecuteQueryMysql(dns, datos["dbquery"].(string), params...)
+				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+				return
+			}
+			if consulta.Querytype == "alter" {
+				dat, err := AlterTableMysql(ctx, dns, consulta.Dbquery)
 				if err != nil {
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
 				return
 			}
-			if datos["querytype"].(string) == "alter" {
-				dat, err := AlterTableMysql(dns, datos["dbquery"].(string))
+			if consulta.Querytype == "batch" {
+				dat, err := BatchExecuteMysql(ctx, dns, consulta.Statements)
 				if err != nil {
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
@@ -384,58 +230,127 @@ func main() {
 			}
 		}
 
-		if datos["dbtype"].(string) == "badgerdb" {
-			if datos["querytype"].(string) == "select" {
-				db, err := InitDB("./" + datos["dbname"].(string))
+		if consulta.DbType == "badgerdb" {
+			dbPath, err := ResolveDbPath(consulta.Dbname)
+			if err != nil {
+				RespondError(c, err)
+				return
+			}
+			db, release, err := AcquireBadger(dbPath)
+			if err != nil {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) {
+					err = NewAPIError(http.StatusInternalServerError, CodeKvError, err.Error())
+				}
+				RespondError(c, err)
+				return
+			}
+			defer release()
+
+			if consulta.Querytype == "select" {
+				dat, err := SelectKV(db, consulta.Dbquery)
 				if err != nil {
-					db.Close()
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
-				dat, err := SelectKV(db, datos["dbquery"].(string))
-				if err != nil {
-					db.Close()
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+				if formato := OutputFormat(c, consulta.Format); formato != FormatJSON {
+					fila := map[string]any{"key": consulta.Dbquery, "value": decodeKV(dat)}
+					RespondKV(c, formato, ResultSet{Names: []string{"key", "value"}, Rows: []map[string]any{fila}}, nil)
 					return
 				}
-				db.Close()
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
 				return
 			}
 
-			if datos["querytype"].(string) == "exec" {
-				db, err := InitDB("./" + datos["dbname"].(string))
+			if consulta.Querytype == "exec" {
+				params := consulta.Params
+				if params == nil {
+					params = make([]any, 0)
+				}
+				jsonData, err := json.Marshal(params)
+				if err != nil {
+					RespondError(c, err)
+					return
+				}
+				err = InsertKV(db, consulta.Dbquery, jsonData)
 				if err != nil {
-					db.Close()
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
-				params := make([]any, 0)
-				if datos["params"] != nil {
-					params = datos["params"].([]any)
+				c.JSON(http.StatusOK, gin.H{"status": "success", "data": "ok"})
+				return
+			}
+
+			if consulta.Querytype == "update" || consulta.Querytype == "upsert" {
+				params := consulta.Params
+				if params == nil {
+					params = make([]any, 0)
 				}
 				jsonData, err := json.Marshal(params)
 				if err != nil {
-					db.Close()
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
+					return
+				}
+				if consulta.Querytype == "update" {
+					err = UpdateKV(db, consulta.Dbquery, jsonData)
+				} else {
+					err = UpsertKV(db, consulta.Dbquery, jsonData)
+				}
+				if err != nil {
+					RespondError(c, err)
 					return
 				}
-				err = InsertKV(db, datos["dbquery"].(string), jsonData)
+				c.JSON(http.StatusOK, gin.H{"status": "success", "data": "ok"})
+				return
+			}
+
+			if consulta.Querytype == "delete" {
+				err := DeleteVK(db, consulta.Dbquery)
 				if err != nil {
-					db.Close()
-					c.JSON(http.StatusOK, gin.H{"status": "error", "message": err.Error()})
+					RespondError(c, err)
 					return
 				}
-				db.Close()
 				c.JSON(http.StatusOK, gin.H{"status": "success", "data": "ok"})
 				return
 			}
+
+			if consulta.Querytype == "list" {
+				dat, err := PageKV(db, consulta.Querytype, consulta.Dbquery, consulta.Page, limites)
+				if err != nil {
+					RespondError(c, err)
+					return
+				}
+				RespondKV(c, OutputFormat(c, consulta.Format), dat, consulta.Page)
+				return
+			}
+
+			if consulta.Querytype == "find" {
+				dat, err := FindKV(db, consulta.Dbquery, consulta.Page, limites)
+				if err != nil {
+					RespondError(c, err)
+					return
+				}
+				RespondKV(c, OutputFormat(c, consulta.Format), dat, consulta.Page)
+				return
+			}
+
+			if consulta.Querytype == "batch" {
+				dat, err := BatchKV(db, consulta.Statements)
+				if err != nil {
+					RespondError(c, err)
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"status": "success", "data": dat})
+				return
+			}
 		}
 
 	})
 
 	fmt.Println("SERVIDOR FUNCIONANDO CORRECTAMENTE")
-	r.Run("0.0.0.0:" + confs["port"])
+	if err := srv.Run(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
 }
 
 func executeTor() {
@@ -522,6 +437,12 @@ func LoadConfs() (map[string]string, error) {
 func CreateConfig() {
 	_, err := os.ReadFile("dbsettings.json")
 	if err != nil {
+		// cada instalación nueva tiene su propia apikey
+		apikey, err := randomHex(32)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 		newSettings := map[string]interface{}{
 			"port":   "5003",
 			"tor":    "9050",
@@ -531,7 +452,43 @@ func CreateConfig() {
 			"dbhost": "127.0.0.1",
 			"dbtype": "sqlite3",
 			"dbname": "dbname",
-			"apikey": "apikey",
+			"apikey": apikey,
+
+			"maxopenconns":    "25",
+			"maxidleconns":    "5",
+			"connmaxlifetime": "300",
+			"connmaxidletime": "60",
+
+			"badgeridletimeout": "600",
+
+			"requiresignature": "false",
+			"signaturewindow":  "300",
+			"maxbodybytes":     "10485760",
+
+			"datadir":     "data",
+			"allowcreate": "true",
+			"databases":   "",
+
+			"allowmultistatements": "false",
+
+			"shutdowntimeout": "30",
+
+			"backupinsertrows":  "1000",
+			"backupinsertbytes": "1048576",
+			"backupcompression": "",
+
+			"backupschedule":    defaultBackupSchedule,
+			"backupkeeplast":    "24",
+			"backupkeepdaily":   "7",
+			"backupkeepweekly":  "4",
+			"backupkeepmonthly": "12",
+
+			"backupbadgerincrementals": "24",
+			"backuponstart":            "true",
+
+			"maxrows":          "100000",
+			"maxresponsebytes": "67108864",
+			"querytimeout":     "30",
 		}
 		confs, err := json.MarshalIndent(newSettings, "", "  ")
 		if err != nil {
@@ -539,6 +496,7 @@ func CreateConfig() {
 			return
 		}
 		os.WriteFile("dbsettings.json", confs, 0777)
+		PrintGreen("Se creó dbsettings.json con una apikey nueva")
 	}
 }
 
@@ -548,121 +506,24 @@ func Connection(usuario, contrasena, host, puerto, baseDatos string) string {
 }
 
 func AssocMysql(dsn string, consulta string) ([]map[string]interface{}, error) {
-
-	// Conectar a la base de datos
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close() // Cerrar la conexión al final de la función
-	filas, err := db.Query(consulta)
-	if err != nil {
-		return nil, err
-	}
-	defer filas.Close()
-
-	columnas, err := filas.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	// Crear un slice para almacenar los registros
-	var registros []map[string]interface{}
-
-	// Preparar un slice para almacenar los valores de cada fila
-	valores := make([]interface{}, len(columnas))
-	punteros := make([]interface{}, len(columnas))
-	for i := range punteros {
-		punteros[i] = &valores[i]
-	}
-
-	// Iterar sobre las filas
-	for filas.Next() {
-		err := filas.Scan(punteros...)
-		if err != nil {
-			return nil, err
-		}
-
-		// Crear un mapa para la fila actual
-		fila := make(map[string]interface{})
-		for i, col := range columnas {
-			// Convertir valores de tipo []byte a string
-			if b, ok := valores[i].([]byte); ok {
-				fila[col] = string(b)
-			} else {
-				fila[col] = valores[i]
-			}
-		}
-
-		registros = append(registros, fila)
-	}
-
-	return registros, nil
+	resultado, err := SelectMysql(context.Background(), dsn, consulta, SelectOptions{})
+	return resultado.Rows, err
 }
 
 func AssocSecureMysql(dsn string, consulta string, parametros ...interface{}) ([]map[string]interface{}, error) {
-
-	// Conectar a la base de datos
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close() // Cerrar la conexión al final de la función
-	filas, err := db.Query(consulta, parametros...)
-	if err != nil {
-		return nil, err
-	}
-	defer filas.Close()
-
-	columnas, err := filas.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	// Crear un slice para almacenar los registros
-	var registros []map[string]interface{}
-
-	// Preparar un slice para almacenar los valores de cada fila
-	valores := make([]interface{}, len(columnas))
-	punteros := make([]interface{}, len(columnas))
-	for i := range punteros {
-		punteros[i] = &valores[i]
-	}
-
-	// Iterar sobre las filas
-	for filas.Next() {
-		err := filas.Scan(punteros...)
-		if err != nil {
-			return nil, err
-		}
-
-		// Crear un mapa para la fila actual
-		fila := make(map[string]interface{})
-		for i, col := range columnas {
-			// Convertir valores de tipo []byte a string
-			if b, ok := valores[i].([]byte); ok {
-				fila[col] = string(b)
-			} else {
-				fila[col] = valores[i]
-			}
-		}
-
-		registros = append(registros, fila)
-	}
-
-	return registros, nil
+	resultado, err := SelectMysql(context.Background(), dsn, consulta, SelectOptions{}, parametros...)
+	return resultado.Rows, err
 }
 
-func ExecuteQueryMysql(dsn, consulta string, parametros ...interface{}) (sql.Result, error) {
-	// Conectar a la base de datos
-	db, err := sql.Open("mysql", dsn)
+func ExecuteQueryMysql(ctx context.Context, dsn, consulta string, parametros ...interface{}) (map[string]any, error) {
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
-	// Ejecutar la consulta INSERT parametrizada
-	resultado, err := db.Exec(consulta, parametros...)
+	// Ejecutar la consulta parametrizada, puede contener varias sentencias
+	resultado, err := ExecScript(ctx, db, "mysql", consulta, parametros...)
 	if err != nil {
 		return nil, err
 	}
@@ -670,17 +531,16 @@ func ExecuteQueryMysql(dsn, consulta string, parametros ...interface{}) (sql.Res
 	return resultado, nil
 }
 
-func AlterTableMysql(dsn, instruccion string) (sql.Result, error) {
+func AlterTableMysql(ctx context.Context, dsn, instruccion string) (map[string]any, error) {
 
-	// Conectar a la base de datos
-	db, err := sql.Open("mysql", dsn)
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
-	// Ejecutar la instrucción SQL
-	resultado, err := db.Exec(instruccion)
+	// Ejecutar la instrucción SQL, puede contener varias sentencias
+	resultado, err := ExecScript(ctx, db, "mysql", instruccion)
 	if err != nil {
 		return nil, err
 	}
@@ -692,12 +552,11 @@ func ExecuteQueryServerMysql(usuario, contrasena, host, puerto, instruccion stri
 	// Construir la cadena de conexión
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/", usuario, contrasena, host, puerto)
 
-	// Conectar a la base de datos
-	db, err := sql.Open("mysql", dsn)
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
 	// Ejecutar la instrucción SQL
 	resultado, err := db.Exec(instruccion)
@@ -709,11 +568,10 @@ func ExecuteQueryServerMysql(usuario, contrasena, host, puerto, instruccion stri
 }
 
 func QueryMysql(dsn, consulta string) (sql.Result, error) {
-	db, err := sql.Open("mysql", dsn)
+	db, err := GetPool("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
 	// Ejecutar la consulta INSERT parametrizada
 	resultado, err := db.Exec(consulta)
@@ -725,127 +583,21 @@ func QueryMysql(dsn, consulta string) (sql.Result, error) {
 }
 
 func Assoc(dbName string, consulta string) ([]map[string]interface{}, error) {
-	// Abrir la conexión a la base de datos
-	db, err := sql.Open("sqlite3", dbName)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close() // Asegurar que se cierre la conexión al final
-
-	filas, err := db.Query(consulta)
-	if err != nil {
-		fmt.Println(err, "ERRRRRRRRRRRR")
-		return nil, err
-	}
-	defer filas.Close()
-
-	columnas, err := filas.Columns()
-	if err != nil {
-
-		return nil, err
-	}
-
-	// Crear un slice para almacenar los registros
-	var registros []map[string]interface{}
-
-	// Preparar un slice para almacenar los valores de cada fila
-	valores := make([]interface{}, len(columnas))
-	punteros := make([]interface{}, len(columnas))
-	for i := range punteros {
-		punteros[i] = &valores[i]
-	}
-
-	// Iterar sobre las filas
-	for filas.Next() {
-		err := filas.Scan(punteros...)
-		if err != nil {
-			return nil, err
-		}
-
-		// Crear un mapa para la fila actual
-		fila := make(map[string]interface{})
-		for i, col := range columnas {
-			// Manejar valores nulos y convertir []byte a string
-			switch v := valores[i].(type) {
-			case []byte:
-				fila[col] = string(v)
-			case nil:
-				fila[col] = nil // Manejar valores nulos
-			default:
-				fila[col] = v
-			}
-		}
-
-		registros = append(registros, fila)
-	}
-
-	return registros, nil
+	resultado, err := SelectSqlite(context.Background(), dbName, consulta, SelectOptions{})
+	return resultado.Rows, err
 }
 
 func AssocSecure(dbName string, consulta string, parametros ...interface{}) ([]map[string]interface{}, error) {
-	// Abrir la conexión a la base de datos
-	db, err := sql.Open("sqlite3", dbName)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close() // Asegurar que se cierre la conexión al final
-
-	filas, err := db.Query(consulta, parametros...)
-	if err != nil {
-		fmt.Println(err, "ERRRRRRRRRRRR")
-		return nil, err
-	}
-	defer filas.Close()
-
-	columnas, err := filas.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	// Crear un slice para almacenar los registros
-	var registros []map[string]interface{}
-
-	// Preparar un slice para almacenar los valores de cada fila
-	valores := make([]interface{}, len(columnas))
-	punteros := make([]interface{}, len(columnas))
-	for i := range punteros {
-		punteros[i] = &valores[i]
-	}
-
-	// Iterar sobre las filas
-	for filas.Next() {
-		err := filas.Scan(punteros...)
-		if err != nil {
-			return nil, err
-		}
-
-		// Crear un mapa para la fila actual
-		fila := make(map[string]interface{})
-		for i, col := range columnas {
-			// Manejar valores nulos y convertir []byte a string
-			switch v := valores[i].(type) {
-			case []byte:
-				fila[col] = string(v)
-			case nil:
-				fila[col] = nil // Manejar valores nulos
-			default:
-				fila[col] = v
-			}
-		}
-
-		registros = append(registros, fila)
-	}
-
-	return registros, nil
+	resultado, err := SelectSqlite(context.Background(), dbName, consulta, SelectOptions{}, parametros...)
+	return resultado.Rows, err
 }
 
 func QuerySecure(dbName string, consulta string, parametros ...interface{}) (sql.Result, error) {
-	// Conectar a la base de datos
-	db, err := sql.Open("sqlite3", dbName)
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("sqlite3", WriterDSN(dbName))
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
 	// Ejecutar la consulta UPDATE parametrizada
 	resultado, err := db.Exec(consulta, parametros...)
@@ -857,16 +609,15 @@ func QuerySecure(dbName string, consulta string, parametros ...interface{}) (sql
 	return resultado, nil
 }
 
-func Execute(dbName string, consulta string, parametros ...interface{}) (sql.Result, error) {
-	// Conectar a la base de datos
-	db, err := sql.Open("sqlite3", dbName)
+func Execute(ctx context.Context, dbName string, consulta string, parametros ...interface{}) (map[string]any, error) {
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("sqlite3", WriterDSN(dbName))
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
-	// Ejecutar la consulta INSERT parametrizada
-	resultado, err := db.Exec(consulta, parametros...)
+	// Ejecutar la consulta parametrizada, puede contener varias sentencias
+	resultado, err := ExecScript(ctx, db, "sqlite3", consulta, parametros...)
 	if err != nil {
 		fmt.Println(err, "ERRRRRRRRRRRR")
 		return nil, err
@@ -875,16 +626,15 @@ func Execute(dbName string, consulta string, parametros ...interface{}) (sql.Res
 	return resultado, nil
 }
 
-func AlterTable(dbName string, instruccion string) (sql.Result, error) {
-	// Conectar a la base de datos
-	db, err := sql.Open("sqlite3", dbName)
+func AlterTable(ctx context.Context, dbName string, instruccion string) (map[string]any, error) {
+	// Obtener el pool de conexiones compartido
+	db, err := GetPool("sqlite3", WriterDSN(dbName))
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close() // Cerrar la conexión al final de la función
 
-	// Ejecutar la instrucción SQL
-	resultado, err := db.Exec(instruccion)
+	// Ejecutar la instrucción SQL, puede contener varias sentencias
+	resultado, err := ExecScript(ctx, db, "sqlite3", instruccion)
 	if err != nil {
 		fmt.Println(err, "ERRRRRRRRRRRR")
 		return nil, err
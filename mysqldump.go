@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tipos de columna que se vuelcan sin comillas
+var dumpNumericTypes = map[string]bool{
+	"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "BIGINT": true,
+	"UNSIGNED TINYINT": true, "UNSIGNED SMALLINT": true, "UNSIGNED MEDIUMINT": true, "UNSIGNED INT": true, "UNSIGNED BIGINT": true,
+	"DECIMAL": true, "FLOAT": true, "DOUBLE": true, "YEAR": true,
+}
+
+// tipos de columna que se vuelcan como literal hexadecimal
+var dumpBinaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"BIT": true, "GEOMETRY": true,
+}
+
+// el DEFINER de vistas, triggers y rutinas se omite para poder restaurar con
+// otro usuario, el objeto queda definido por quien restaura
+var definerPattern = regexp.MustCompile("DEFINER=(`[^`]*`|'[^']*'|[^ ]*)@(`[^`]*`|'[^']*'|[^ ]*) ")
+
+// mysqlDump escribe el respaldo de una base MySQL. Todas las lecturas se hacen
+// en una conexión con una transacción REPEATABLE READ WITH CONSISTENT SNAPSHOT,
+// así los datos de todas las tablas corresponden al mismo momento
+type mysqlDump struct {
+	ctx  context.Context
+	conn *sql.Conn
+	base string
+	w    io.Writer
+	err  error // primer error de escritura
+
+	// límites de cada INSERT, al alcanzar cualquiera se empieza otro; así la
+	// restauración no supera max_allowed_packet
+	insertRows  int
+	insertBytes int
+}
+
+// printf escribe en el respaldo, después de un error no escribe más
+func (d *mysqlDump) printf(formato string, args ...any) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, formato, args...)
+	}
+}
+
+// quoteIdent escribe un identificador MySQL entre comillas invertidas
+func quoteIdent(nombre string) string {
+	return "`" + strings.ReplaceAll(nombre, "`", "``") + "`"
+}
+
+// quoteString escribe un literal de texto con los escapes de mysql_real_escape_string,
+// válido mientras la sesión no use NO_BACKSLASH_ESCAPES (ver dumpHeader)
+func quoteString(valor []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(valor) + 2)
+	sb.WriteByte('\'')
+	for _, b := range valor {
+		switch b {
+		case 0:
+			sb.WriteString(`\0`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '"':
+			sb.WriteString(`\"`)
+		case 0x1a:
+			sb.WriteString(`\Z`)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+// dumpValue escribe un valor según el tipo de su columna: NULL, número sin
+// comillas, binario en hexadecimal y el resto como texto escapado
+func dumpValue(valor sql.RawBytes, tipo string) string {
+	switch {
+	case valor == nil:
+		return "NULL"
+	case dumpNumericTypes[tipo]:
+		return string(valor)
+	case dumpBinaryTypes[tipo]:
+		if len(valor) == 0 {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString(valor)
+	}
+	return quoteString(valor)
+}
+
+// queryStrings devuelve la columna indicada de cada fila de la consulta
+func (d *mysqlDump) queryStrings(columna int, consulta string, args ...any) ([]string, error) {
+	filas, err := d.conn.QueryContext(d.ctx, consulta, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer filas.Close()
+	columnas, err := filas.Columns()
+	if err != nil {
+		return nil, err
+	}
+	valores := make([]sql.NullString, len(columnas))
+	punteros := make([]any, len(columnas))
+	for i := range valores {
+		punteros[i] = &valores[i]
+	}
+	var resultado []string
+	for filas.Next() {
+		if err := filas.Scan(punteros...); err != nil {
+			return nil, err
+		}
+		resultado = append(resultado, valores[columna].String)
+	}
+	return resultado, filas.Err()
+}
+
+// showCreate devuelve la sentencia de creación de un objeto (SHOW CREATE ...),
+// columna es la posición de la sentencia en el resultado
+func (d *mysqlDump) showCreate(columna int, consulta string) (string, error) {
+	resultado, err := d.queryStrings(columna, consulta)
+	if err != nil {
+		return "", err
+	}
+	if len(resultado) == 0 || resultado[0] == "" {
+		return "", fmt.Errorf("sin permisos para leer la definición (%s)", consulta)
+	}
+	return resultado[0], nil
+}
+
+func (d *mysqlDump) dumpHeader() {
+	d.printf("-- Backup de %s\n", d.base)
+	d.printf("-- Fecha: %s\n\n", time.Now().Format("2006-01-02 15:04:05"))
+	d.printf("SET NAMES utf8mb4;\n")
+	d.printf("SET TIME_ZONE='+00:00';\n")
+	d.printf("SET SQL_MODE='NO_AUTO_VALUE_ON_ZERO';\n")
+	d.printf("SET FOREIGN_KEY_CHECKS=0;\n")
+	d.printf("SET UNIQUE_CHECKS=0;\n\n")
+	d.printf("CREATE DATABASE IF NOT EXISTS %s;\n", quoteIdent(d.base))
+	d.printf("USE %s;\n", quoteIdent(d.base))
+}
+
+func (d *mysqlDump) dumpFooter() {
+	d.printf("\nSET FOREIGN_KEY_CHECKS=1;\n")
+	d.printf("SET UNIQUE_CHECKS=1;\n")
+}
+
+// dumpTable escribe la estructura y los datos de una tabla en INSERT de varias
+// filas (ver insertRows e insertBytes). Las columnas generadas no se insertan,
+// la base las calcula al restaurar
+func (d *mysqlDump) dumpTable(tabla string) error {
+	create, err := d.showCreate(1, "SHOW CREATE TABLE "+quoteIdent(tabla))
+	if err != nil {
+		return err
+	}
+	d.printf("\n-- Estructura de tabla: %s\n", tabla)
+	d.printf("DROP TABLE IF EXISTS %s;\n", quoteIdent(tabla))
+	d.printf("%s;\n", create)
+
+	columnas, err := d.queryStrings(0, `SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND EXTRA NOT IN ('VIRTUAL GENERATED', 'STORED GENERATED')
+		ORDER BY ORDINAL_POSITION`, d.base, tabla)
+	if err != nil {
+		return err
+	}
+	nombres := make([]string, len(columnas))
+	for i, col := range columnas {
+		nombres[i] = quoteIdent(col)
+	}
+	lista := strings.Join(nombres, ",")
+
+	filas, err := d.conn.QueryContext(d.ctx, "SELECT "+lista+" FROM "+quoteIdent(tabla))
+	if err != nil {
+		return err
+	}
+	defer filas.Close()
+	tipos, err := filas.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	valores := make([]sql.RawBytes, len(tipos))
+	punteros := make([]any, len(tipos))
+	for i := range valores {
+		punteros[i] = &valores[i]
+	}
+	literales := make([]string, len(tipos))
+	insert := "INSERT INTO " + quoteIdent(tabla) + " (" + lista + ") VALUES\n"
+
+	total, enInsert, bytes := 0, 0, 0
+	for filas.Next() {
+		if err := filas.Scan(punteros...); err != nil {
+			return err
+		}
+		for i, valor := range valores {
+			literales[i] = dumpValue(valor, tipos[i].DatabaseTypeName())
+		}
+		fila := "(" + strings.Join(literales, ",") + ")"
+
+		if enInsert > 0 && (enInsert >= d.insertRows || bytes+len(fila) > d.insertBytes) {
+			d.printf(";\n")
+			enInsert = 0
+		}
+		if total == 0 {
+			d.printf("\n-- Datos de tabla: %s\n", tabla)
+		}
+		if enInsert == 0 {
+			d.printf("%s", insert)
+			bytes = len(insert)
+		} else {
+			d.printf(",\n")
+		}
+		d.printf("%s", fila)
+		bytes += len(fila) + 2
+		enInsert++
+		total++
+	}
+	if total > 0 {
+		d.printf(";\n")
+	}
+	if err := filas.Err(); err != nil {
+		return err
+	}
+	return d.err
+}
+
+// dumpViews escribe las vistas después de las tablas y las rutinas. Primero
+// crea cada vista como un SELECT de constantes con las mismas columnas, así
+// las vistas que usan otras vistas se crean en cualquier orden
+func (d *mysqlDump) dumpViews(vistas []string) error {
+	if len(vistas) == 0 {
+		return nil
+	}
+	d.printf("\n-- Vistas\n")
+	for _, vista := range vistas {
+		columnas, err := d.queryStrings(0, `SELECT COLUMN_NAME FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`, d.base, vista)
+		if err != nil {
+			return err
+		}
+		campos := make([]string, len(columnas))
+		for i, col := range columnas {
+			campos[i] = "1 AS " + quoteIdent(col)
+		}
+		d.printf("DROP TABLE IF EXISTS %s;\n", quoteIdent(vista))
+		d.printf("DROP VIEW IF EXISTS %s;\n", quoteIdent(vista))
+		d.printf("CREATE VIEW %s AS SELECT %s;\n", quoteIdent(vista), strings.Join(campos, ","))
+	}
+	for _, vista := range vistas {
+		create, err := d.showCreate(1, "SHOW CREATE VIEW "+quoteIdent(vista))
+		if err != nil {
+			return err
+		}
+		d.printf("DROP VIEW IF EXISTS %s;\n", quoteIdent(vista))
+		d.printf("%s;\n", definerPattern.ReplaceAllString(create, ""))
+	}
+	return d.err
+}
+
+// dumpRoutines escribe procedimientos y funciones entre DELIMITER ;; para que
+// el ; del cuerpo no corte la sentencia
+func (d *mysqlDump) dumpRoutines() error {
+	for _, tipo := range []string{"PROCEDURE", "FUNCTION"} {
+		nombres, err := d.queryStrings(1, "SHOW "+tipo+" STATUS WHERE Db = ?", d.base)
+		if err != nil {
+			return err
+		}
+		for _, nombre := range nombres {
+			create, err := d.showCreate(2, "SHOW CREATE "+tipo+" "+quoteIdent(nombre))
+			if err != nil {
+				return err
+			}
+			d.printf("\n-- Rutina: %s\n", nombre)
+			d.printf("DROP %s IF EXISTS %s;\n", tipo, quoteIdent(nombre))
+			d.printf("DELIMITER ;;\n%s;;\nDELIMITER ;\n", definerPattern.ReplaceAllString(create, ""))
+		}
+	}
+	return d.err
+}
+
+// dumpTriggers escribe los triggers al final, después de los datos, para que
+// no se ejecuten durante la restauración
+func (d *mysqlDump) dumpTriggers() error {
+	nombres, err := d.queryStrings(0, "SHOW TRIGGERS")
+	if err != nil {
+		return err
+	}
+	for _, nombre := range nombres {
+		create, err := d.showCreate(2, "SHOW CREATE TRIGGER "+quoteIdent(nombre))
+		if err != nil {
+			return err
+		}
+		d.printf("\n-- Trigger: %s\n", nombre)
+		d.printf("DROP TRIGGER IF EXISTS %s;\n", quoteIdent(nombre))
+		d.printf("DELIMITER ;;\n%s;;\nDELIMITER ;\n", definerPattern.ReplaceAllString(create, ""))
+	}
+	return d.err
+}
+
+// Dump escribe el respaldo completo: tablas con sus datos, rutinas, vistas y
+// triggers, con las claves foráneas desactivadas durante la restauración
+func (d *mysqlDump) Dump() error {
+	// la sesión en UTC hace que los TIMESTAMP se restauren igual en cualquier servidor
+	for _, sentencia := range []string{
+		"SET SESSION TIME_ZONE = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+	} {
+		if _, err := d.conn.ExecContext(d.ctx, sentencia); err != nil {
+			return fmt.Errorf("error iniciando la transacción del respaldo: %v", err)
+		}
+	}
+	defer d.conn.ExecContext(context.Background(), "ROLLBACK")
+
+	filas, err := d.conn.QueryContext(d.ctx, "SHOW FULL TABLES")
+	if err != nil {
+		return fmt.Errorf("error obteniendo tablas: %v", err)
+	}
+	var tablas, vistas []string
+	for filas.Next() {
+		var nombre, tipo string
+		if err := filas.Scan(&nombre, &tipo); err != nil {
+			filas.Close()
+			return fmt.Errorf("error obteniendo tablas: %v", err)
+		}
+		if tipo == "VIEW" {
+			vistas = append(vistas, nombre)
+		} else {
+			tablas = append(tablas, nombre)
+		}
+	}
+	filas.Close()
+	if err := filas.Err(); err != nil {
+		return fmt.Errorf("error obteniendo tablas: %v", err)
+	}
+
+	d.dumpHeader()
+	for _, tabla := range tablas {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		if err := d.dumpTable(tabla); err != nil {
+			return fmt.Errorf("error respaldando tabla %s: %v", tabla, err)
+		}
+		fmt.Println("Respaldo de: ", tabla)
+	}
+	if err := d.dumpRoutines(); err != nil {
+		return fmt.Errorf("error respaldando rutinas: %v", err)
+	}
+	if err := d.dumpViews(vistas); err != nil {
+		return fmt.Errorf("error respaldando vistas: %v", err)
+	}
+	if err := d.dumpTriggers(); err != nil {
+		return fmt.Errorf("error respaldando triggers: %v", err)
+	}
+	d.dumpFooter()
+	return d.err
+}
+
+// createBackup escribe el respaldo de config.Database en BackupDir (ver
+// backupFile), ante un error o al apagar el servidor se descarta y el respaldo
+// anterior con el mismo nombre se mantiene
+func createBackup(ctx context.Context, config BackupConfig) error {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+		config.User,
+		config.Password,
+		config.Host,
+		config.Port,
+		config.Database,
+	)
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return fmt.Errorf("error conectando a la base de datos: %v", err)
+	}
+	defer db.Close()
+
+	// todas las lecturas van por la misma conexión, la de la transacción
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error verificando conexión: %v", err)
+	}
+	defer conn.Close()
+
+	// Crear archivo de backup
+	file, err := createBackupFile(backupName(config.BackupDir, config.Database, time.Now())+".sql", config.Compression)
+	if err != nil {
+		return err
+	}
+
+	dump := &mysqlDump{
+		ctx:         ctx,
+		conn:        conn,
+		base:        config.Database,
+		w:           file,
+		insertRows:  config.InsertRows,
+		insertBytes: config.InsertBytes,
+	}
+	if err := dump.Dump(); err != nil {
+		file.Abort()
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Backup creado exitosamente: %s", file.Name)
+	PrintGreen("BACKUP CREADO EXITOSAMENTE")
+	return nil
+}
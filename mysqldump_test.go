@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestQuoteString(t *testing.T) {
+	casos := []struct {
+		valor    string
+		esperado string
+	}{
+		{"", `''`},
+		{"texto", `'texto'`},
+		{"O'Brien", `'O\'Brien'`},
+		{`dijo "hola"`, `'dijo \"hola\"'`},
+		{`C:\datos\`, `'C:\\datos\\'`},
+		{`\'`, `'\\\''`}, // la barra no puede escapar la comilla siguiente
+		{"a\x00b", `'a\0b'`},
+		{"línea 1\r\nlínea 2", `'línea 1\r\nlínea 2'`},
+		{"fin\x1a", `'fin\Z'`},
+		{"\t%_", "'\t%_'"}, // tabulador y comodines de LIKE van sin escapar
+		{"x'); DROP TABLE t; --", `'x\'); DROP TABLE t; --'`},
+		{"\xff\xfe\x80", "'\xff\xfe\x80'"},
+	}
+	for _, caso := range casos {
+		if obtenido := quoteString([]byte(caso.valor)); obtenido != caso.esperado {
+			t.Errorf("%q: obtenido %s, esperado %s", caso.valor, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestDumpValue(t *testing.T) {
+	casos := []struct {
+		valor    sql.RawBytes
+		tipo     string
+		esperado string
+	}{
+		{nil, "VARCHAR", "NULL"},
+		{nil, "INT", "NULL"},
+		{nil, "BLOB", "NULL"},
+		{sql.RawBytes{}, "VARCHAR", "''"}, // texto vacío, no NULL
+		{sql.RawBytes("NULL"), "VARCHAR", "'NULL'"},
+		{sql.RawBytes("-12"), "INT", "-12"},
+		{sql.RawBytes("18446744073709551615"), "UNSIGNED BIGINT", "18446744073709551615"},
+		{sql.RawBytes("12345678901234567890.123456789"), "DECIMAL", "12345678901234567890.123456789"},
+		{sql.RawBytes("2026"), "YEAR", "2026"},
+		{sql.RawBytes("2026-10-18 03:00:00"), "DATETIME", "'2026-10-18 03:00:00'"},
+		{sql.RawBytes(`{"a":"b\\c"}`), "JSON", `'{\"a\":\"b\\\\c\"}'`},
+		{sql.RawBytes("it's"), "TEXT", `'it\'s'`},
+		{sql.RawBytes{0, '\'', '\\', 0xff, 0x1a}, "BLOB", "0x00275cff1a"},
+		{sql.RawBytes{0, 1}, "VARBINARY", "0x0001"},
+		{sql.RawBytes{}, "LONGBLOB", "''"},
+		{sql.RawBytes{0x05}, "BIT", "0x05"},
+		{sql.RawBytes{0, '\''}, "BINARY", "0x0027"},
+	}
+	for _, caso := range casos {
+		if obtenido := dumpValue(caso.valor, caso.tipo); obtenido != caso.esperado {
+			t.Errorf("%q %s: obtenido %s, esperado %s", caso.valor, caso.tipo, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	casos := map[string]string{
+		"ventas":        "`ventas`",
+		"mi tabla":      "`mi tabla`",
+		"a`b":           "`a``b`",
+		"`; DROP t; --": "```; DROP t; --`",
+	}
+	for nombre, esperado := range casos {
+		if obtenido := quoteIdent(nombre); obtenido != esperado {
+			t.Errorf("%q: obtenido %s, esperado %s", nombre, obtenido, esperado)
+		}
+	}
+}
+
+func TestDefinerPattern(t *testing.T) {
+	casos := map[string]string{
+		"CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`localhost` SQL SECURITY DEFINER VIEW `v` AS select 1": "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `v` AS select 1",
+		"CREATE DEFINER=`a@b`@`%` PROCEDURE `p`() BEGIN END":                                              "CREATE PROCEDURE `p`() BEGIN END",
+		"CREATE DEFINER='app'@'10.0.0.1' TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET @a = 1":            "CREATE TRIGGER t BEFORE INSERT ON x FOR EACH ROW SET @a = 1",
+		"CREATE DEFINER=app@localhost FUNCTION f() RETURNS INT RETURN 1":                                  "CREATE FUNCTION f() RETURNS INT RETURN 1",
+	}
+	for create, esperado := range casos {
+		if obtenido := definerPattern.ReplaceAllString(create, ""); obtenido != esperado {
+			t.Errorf("%s: obtenido %s", create, obtenido)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PageRequest pide una página de un select o de la lista de claves de badgerdb.
+// En SQL la página se arma por keyset sobre las columnas de Key, que deben
+// identificar cada fila y no ser NULL; en badgerdb se recorre en orden de clave
+type PageRequest struct {
+	Size   int      `json:"size"`
+	Cursor string   `json:"cursor"` // valor de "next" de la página anterior
+	Key    []string `json:"key"`
+	Desc   bool     `json:"desc"`
+}
+
+// pageCursor es el contenido del cursor opaco: los valores de la clave de la
+// última fila y una huella de la consulta para no mezclar cursores
+type pageCursor struct {
+	Values []any  `json:"v"`
+	Query  string `json:"q"`
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// Validate comprueba la página según el tipo de base de datos
+func (p *PageRequest) Validate(dbtype string) []FieldError {
+	var errores []FieldError
+	if p.Size < 1 {
+		errores = append(errores, FieldError{Field: "page.size", Message: "debe ser mayor que 0"})
+	}
+	if dbtype == "badgerdb" {
+		return errores
+	}
+	if len(p.Key) == 0 {
+		errores = append(errores, FieldError{Field: "page.key", Message: "campo requerido, indique las columnas que identifican cada fila"})
+	}
+	for i, col := range p.Key {
+		if !identifierPattern.MatchString(col) {
+			errores = append(errores, FieldError{Field: fmt.Sprintf("page.key[%d]", i), Message: fmt.Sprintf("nombre de columna '%s' inválido", col)})
+		}
+	}
+	return errores
+}
+
+// fingerprint identifica la consulta a la que pertenece un cursor
+func (p *PageRequest) fingerprint(partes ...any) string {
+	dat, _ := json.Marshal(append(partes, p.Key, p.Desc))
+	suma := sha256.Sum256(dat)
+	return hex.EncodeToString(suma[:8])
+}
+
+// decodeCursor devuelve los valores del cursor, nil si es la primera página
+func (p *PageRequest) decodeCursor(huella string, cantidad int) ([]any, error) {
+	if p.Cursor == "" {
+		return nil, nil
+	}
+	invalido := NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "page.cursor inválido")
+	dat, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, invalido
+	}
+	var cursor pageCursor
+	if err := decodeJSON(dat, &cursor); err != nil || len(cursor.Values) != cantidad {
+		return nil, invalido
+	}
+	if cursor.Query != huella {
+		return nil, NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "page.cursor pertenece a otra consulta")
+	}
+	if _, err := normalizeParams(cursor.Values); err != nil {
+		return nil, invalido
+	}
+	return cursor.Values, nil
+}
+
+func encodeCursor(huella string, valores []any) string {
+	for i, valor := range valores {
+		switch v := valor.(type) {
+		case time.Time:
+			// las fechas se guardan con el mismo formato con que se comparan en la base
+			valores[i] = v.Format(datetimeLayout)
+		case []byte:
+			// los blobs van como parámetro tipado para compararse como blob y no como texto
+			valores[i] = map[string]any{"type": "blob", "value": base64.StdEncoding.EncodeToString(v)}
+		}
+	}
+	dat, _ := json.Marshal(pageCursor{Values: valores, Query: huella})
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+// Apply envuelve el select para devolver Size+1 filas a partir del cursor:
+//
+//	SELECT * FROM (consulta) AS _pagina WHERE (k1 > ? OR (k1 = ? AND k2 > ?)) ORDER BY k1, k2 LIMIT n
+//
+// La fila adicional indica si hay otra página
+func (p *PageRequest) Apply(dbtype, consulta string, parametros []any) (string, []any, error) {
+	desde, err := p.decodeCursor(p.fingerprint(consulta, parametros), len(p.Key))
+	if err != nil {
+		return "", nil, err
+	}
+	sentencias := SplitStatements(consulta, dbtype == "mysql")
+	if len(sentencias) != 1 {
+		return "", nil, NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "page solo se admite con una sentencia select")
+	}
+
+	comillas := `"`
+	if dbtype == "mysql" {
+		comillas = "`"
+	}
+	columnas := make([]string, len(p.Key))
+	for i, col := range p.Key {
+		columnas[i] = comillas + col + comillas
+	}
+	comparador, direccion := ">", ""
+	if p.Desc {
+		comparador, direccion = "<", " DESC"
+	}
+
+	var sb strings.Builder
+	// el salto de línea evita que un comentario -- al final de la consulta anule el paréntesis
+	sb.WriteString("SELECT * FROM (\n" + sentencias[0].Text + "\n) AS _pagina")
+	params := append([]any{}, parametros...)
+	if desde != nil {
+		var condiciones []string
+		for i := range columnas {
+			var partes []string
+			for j := 0; j < i; j++ {
+				partes = append(partes, columnas[j]+" = ?")
+				params = append(params, desde[j])
+			}
+			partes = append(partes, columnas[i]+" "+comparador+" ?")
+			params = append(params, desde[i])
+			condiciones = append(condiciones, "("+strings.Join(partes, " AND ")+")")
+		}
+		sb.WriteString(" WHERE " + strings.Join(condiciones, " OR "))
+	}
+	sb.WriteString(" ORDER BY ")
+	for i, col := range columnas {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(col + direccion)
+	}
+	sb.WriteString(" LIMIT " + strconv.Itoa(p.Size+1))
+	return sb.String(), params, nil
+}
+
+// CheckColumns comprueba que las columnas de Key estén en el resultado con el
+// mismo nombre, si no el cursor no tendría sus valores
+func (p *PageRequest) CheckColumns(columnas []string) error {
+	for _, col := range p.Key {
+		if !slices.Contains(columnas, col) {
+			return NewAPIError(http.StatusBadRequest, CodeInvalidRequest,
+				fmt.Sprintf("page.key: la columna '%s' no está en el resultado del select", col))
+		}
+	}
+	return nil
+}
+
+// NextCursor arma el cursor de la página siguiente con los valores de Key de
+// la última fila tal como los leyó el driver (ver rowScanner.KeyValues), no
+// como se muestran con metadata. consulta y parametros son los mismos que
+// recibió Apply
+func (p *PageRequest) NextCursor(consulta string, parametros []any, valores []any) string {
+	return encodeCursor(p.fingerprint(consulta, parametros), valores)
+}
+
+// KVStart devuelve la última clave de la página anterior, vacía en la primera página
+func (p *PageRequest) KVStart(querytype, expresion string) (string, error) {
+	desde, err := p.decodeCursor(p.fingerprint(querytype, expresion), 1)
+	if err != nil || desde == nil {
+		return "", err
+	}
+	clave, ok := desde[0].(string)
+	if !ok {
+		return "", NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "page.cursor inválido")
+	}
+	return clave, nil
+}
+
+// KVCursor arma el cursor de la página siguiente a partir de la última clave
+func (p *PageRequest) KVCursor(querytype, expresion, clave string) string {
+	return encodeCursor(p.fingerprint(querytype, expresion), []any{clave})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPageRequestApply(t *testing.T) {
+	pagina := &PageRequest{Size: 10, Key: []string{"fecha", "id"}}
+	query, params, err := pagina.Apply("sqlite3", "SELECT * FROM t WHERE a = ? -- fin", []any{int64(1)})
+	esperado := "SELECT * FROM (\nSELECT * FROM t WHERE a = ? -- fin\n) AS _pagina ORDER BY \"fecha\", \"id\" LIMIT 11"
+	if err != nil || query != esperado || !reflect.DeepEqual(params, []any{int64(1)}) {
+		t.Errorf("primera página: %q %v %v", query, params, err)
+	}
+
+	pagina.Cursor = pagina.NextCursor("SELECT * FROM t WHERE a = ? -- fin", []any{int64(1)}, []any{"2026-10-18 03:00:00", int64(7)})
+	pagina.Desc = true
+	if _, _, err := pagina.Apply("sqlite3", "SELECT * FROM t WHERE a = ? -- fin", []any{int64(1)}); err == nil {
+		t.Error("el cursor no debería valer con otro orden")
+	}
+	pagina.Desc = false
+	if _, _, err := pagina.Apply("sqlite3", "SELECT * FROM t WHERE a = ? -- fin", []any{int64(2)}); err == nil {
+		t.Error("el cursor no debería valer con otros parámetros")
+	}
+	if _, _, err := pagina.Apply("sqlite3", "SELECT * FROM u WHERE a = ?", []any{int64(1)}); err == nil {
+		t.Error("el cursor no debería valer con otra consulta")
+	}
+	query, params, err = pagina.Apply("sqlite3", "SELECT * FROM t WHERE a = ? -- fin", []any{int64(1)})
+	esperado = "SELECT * FROM (\nSELECT * FROM t WHERE a = ? -- fin\n) AS _pagina WHERE (\"fecha\" > ?) OR (\"fecha\" = ? AND \"id\" > ?) ORDER BY \"fecha\", \"id\" LIMIT 11"
+	if err != nil || query != esperado || !reflect.DeepEqual(params, []any{int64(1), "2026-10-18 03:00:00", "2026-10-18 03:00:00", int64(7)}) {
+		t.Errorf("página siguiente: %q %v %v", query, params, err)
+	}
+
+	pagina.Cursor = "no es un cursor"
+	if _, _, err := pagina.Apply("sqlite3", "SELECT 1", nil); err == nil {
+		t.Error("se esperaba un error con un cursor inválido")
+	}
+	if _, _, err := (&PageRequest{Size: 1, Key: []string{"id"}}).Apply("sqlite3", "SELECT 1; SELECT 2", nil); err == nil {
+		t.Error("se esperaba un error con varias sentencias")
+	}
+}
+
+func TestKVCursor(t *testing.T) {
+	pagina := &PageRequest{Size: 2}
+	pagina.Cursor = pagina.KVCursor("list", "", "clave:2")
+	if desde, err := pagina.KVStart("list", ""); err != nil || desde != "clave:2" {
+		t.Errorf("obtenido %q %v", desde, err)
+	}
+	if _, err := pagina.KVStart("find", "^a"); err == nil {
+		t.Error("el cursor no debería valer para otra consulta")
+	}
+}
+
+// TestSelectPages recorre todas las páginas de tablas con claves blob y
+// fecha, con y sin metadata: cada fila debe aparecer una sola vez y en orden
+func TestSelectPages(t *testing.T) {
+	ruta := filepath.Join(t.TempDir(), "paginas.db")
+	db, err := sql.Open("sqlite3", ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE b (k BLOB PRIMARY KEY, n INTEGER); CREATE TABLE f (fecha DATETIME, id INTEGER, PRIMARY KEY (fecha, id))"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if _, err := db.Exec("INSERT INTO b VALUES (?, ?)", []byte{byte(i), 0, 0xff}, i); err != nil {
+			t.Fatal(err)
+		}
+		// dos filas por fecha, la página corta entre filas de la misma fecha
+		if _, err := db.Exec("INSERT INTO f VALUES (?, ?)", fmt.Sprintf("2026-10-%02d 03:00:00", 18+i/2), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	casos := []struct {
+		consulta string
+		key      []string
+		columna  string
+	}{
+		{"SELECT n, k FROM b", []string{"k"}, "n"},
+		{"SELECT id, fecha FROM f", []string{"fecha", "id"}, "id"},
+	}
+	for _, caso := range casos {
+		for _, metadata := range []bool{false, true} {
+			for _, desc := range []bool{false, true} {
+				pagina := &PageRequest{Size: 3, Key: caso.key, Desc: desc}
+				var obtenido []int64
+				for paginas := 0; paginas < 10; paginas++ {
+					resultado, err := SelectSqlite(context.Background(), ruta, caso.consulta, SelectOptions{Metadata: metadata, Page: pagina})
+					if err != nil {
+						t.Fatalf("%s: %v", caso.consulta, err)
+					}
+					for _, fila := range resultado.Rows {
+						obtenido = append(obtenido, fila[caso.columna].(int64))
+					}
+					if resultado.Next == "" {
+						break
+					}
+					pagina.Cursor = resultado.Next
+				}
+				esperado := []int64{0, 1, 2, 3, 4, 5, 6}
+				if desc {
+					esperado = []int64{6, 5, 4, 3, 2, 1, 0}
+				}
+				if !reflect.DeepEqual(obtenido, esperado) {
+					t.Errorf("%s metadata=%v desc=%v: obtenido %v, esperado %v", caso.consulta, metadata, desc, obtenido, esperado)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BindParams reescribe dbquery para el driver: los marcadores :nombre se toman de
+// named y se reemplazan por ?, y cada parámetro que sea un array se expande en
+// una lista ?, ?, ? para usarse en IN (...). Un array vacío se reemplaza por NULL,
+// así IN (NULL) no coincide con ninguna fila. El resultado es el mismo para
+// sqlite3 y mysql; backslash tiene el mismo significado que en SplitStatements
+func BindParams(query string, positional []any, named map[string]any, backslash bool) (string, []any, error) {
+	var salida strings.Builder
+	params := make([]any, 0, len(positional)+len(named))
+	usados := make(map[string]struct{})
+	siguiente := 0
+	conNombre, posicionales := false, false
+
+	agregar := func(valor any) error {
+		lista, ok := valor.([]any)
+		if !ok {
+			salida.WriteByte('?')
+			params = append(params, valor)
+			return nil
+		}
+		if len(lista) == 0 {
+			salida.WriteString("NULL")
+			return nil
+		}
+		for i, elemento := range lista {
+			if _, anidado := elemento.([]any); anidado {
+				return fmt.Errorf("los arrays anidados no se pueden expandir")
+			}
+			if i > 0 {
+				salida.WriteString(", ")
+			}
+			salida.WriteByte('?')
+			params = append(params, elemento)
+		}
+		return nil
+	}
+
+	err := scanPlaceholders(query, backslash, salida.WriteString, func(nombre string) error {
+		if nombre == "" && conNombre || nombre != "" && posicionales {
+			return fmt.Errorf("dbquery no puede mezclar marcadores ? y :nombre")
+		}
+		if nombre == "" {
+			posicionales = true
+			if siguiente >= len(positional) {
+				return fmt.Errorf("dbquery tiene más marcadores ? que parámetros")
+			}
+			siguiente++
+			if err := agregar(positional[siguiente-1]); err != nil {
+				return fmt.Errorf("parámetro %d: %v", siguiente-1, err)
+			}
+			return nil
+		}
+		valor, ok := named[nombre]
+		if !ok {
+			return fmt.Errorf("falta el parámetro '%s'", nombre)
+		}
+		conNombre = true
+		usados[nombre] = struct{}{}
+		if err := agregar(valor); err != nil {
+			return fmt.Errorf("parámetro '%s': %v", nombre, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if siguiente < len(positional) {
+		return "", nil, fmt.Errorf("se enviaron %d parámetros y dbquery tiene %d marcadores ?", len(positional), siguiente)
+	}
+	var sobrantes []string
+	for nombre := range named {
+		if _, ok := usados[nombre]; !ok {
+			sobrantes = append(sobrantes, nombre)
+		}
+	}
+	if len(sobrantes) > 0 {
+		sort.Strings(sobrantes)
+		return "", nil, fmt.Errorf("parámetros no usados en dbquery: %s", strings.Join(sobrantes, ", "))
+	}
+	return salida.String(), params, nil
+}
+
+// HasNamedParams indica si dbquery usa marcadores :nombre
+func HasNamedParams(query string, backslash bool) bool {
+	encontrado := false
+	scanPlaceholders(query, backslash, func(string) (int, error) { return 0, nil }, func(nombre string) error {
+		if nombre != "" {
+			encontrado = true
+		}
+		return nil
+	})
+	return encontrado
+}
+
+// scanPlaceholders recorre dbquery copiando con texto todo lo que no es un marcador
+// y llamando a marcador por cada ? (nombre vacío) o :nombre fuera de cadenas y
+// comentarios. "::" y ":=" no se consideran marcadores
+func scanPlaceholders(query string, backslash bool, texto func(string) (int, error), marcador func(nombre string) error) error {
+	runes := []rune(query)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			j := i + 1
+			for j < n && runes[j] != r {
+				if backslash && r != '`' && runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= n {
+				j = n - 1
+			}
+			texto(string(runes[i : j+1]))
+			i = j
+		case isLineComment(runes, i, backslash):
+			j := i
+			for j < n && runes[j] != '\n' {
+				j++
+			}
+			texto(string(runes[i:j]))
+			i = j - 1
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			j := i + 2
+			for j+1 < n && !(runes[j] == '*' && runes[j+1] == '/') {
+				j++
+			}
+			fin := j + 2
+			if fin > n {
+				fin = n
+			}
+			texto(string(runes[i:fin]))
+			i = fin - 1
+		case r == '?':
+			if err := marcador(""); err != nil {
+				return err
+			}
+		case r == ':' && i+1 < n && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '_') && (i == 0 || runes[i-1] != ':'):
+			j := i + 1
+			for j < n && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			if err := marcador(string(runes[i+1 : j])); err != nil {
+				return err
+			}
+			i = j - 1
+		default:
+			texto(string(r))
+		}
+	}
+	return nil
+}
+
+// bindQueryParams aplica BindParams a dbquery y a cada sentencia del lote
+func (c *Consulta) bindQueryParams() []FieldError {
+	backslash := c.DbType == "mysql"
+	if c.Querytype == "batch" {
+		var errores []FieldError
+		for i := range c.Statements {
+			sentencia := &c.Statements[i]
+			query, params, err := BindParams(sentencia.Dbquery, sentencia.Params, nil, backslash)
+			if err != nil {
+				errores = append(errores, FieldError{Field: fmt.Sprintf("statements[%d].params", i), Message: err.Error()})
+				continue
+			}
+			sentencia.Dbquery, sentencia.Params = query, params
+		}
+		return errores
+	}
+	query, params, err := BindParams(c.Dbquery, c.Params, c.NamedParams, backslash)
+	if err != nil {
+		return []FieldError{{Field: "params", Message: err.Error()}}
+	}
+	c.Dbquery, c.Params, c.NamedParams = query, params, nil
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBindParams(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		query      string
+		positional []any
+		named      map[string]any
+		backslash  bool
+		esperado   string
+		params     []any
+		falla      bool
+	}{
+		{"posicionales", "SELECT * FROM t WHERE a = ? AND b = ?", []any{1, "x"}, nil, false,
+			"SELECT * FROM t WHERE a = ? AND b = ?", []any{1, "x"}, false},
+		{"array expandido", "SELECT * FROM t WHERE id IN (?) AND b = ?", []any{[]any{1, 2, 3}, "x"}, nil, false,
+			"SELECT * FROM t WHERE id IN (?, ?, ?) AND b = ?", []any{1, 2, 3, "x"}, false},
+		{"array vacío", "SELECT * FROM t WHERE id IN (?)", []any{[]any{}}, nil, false,
+			"SELECT * FROM t WHERE id IN (NULL)", []any{}, false},
+		{"array anidado", "SELECT * FROM t WHERE id IN (?)", []any{[]any{[]any{1}}}, nil, false, "", nil, true},
+		{"con nombre", "SELECT * FROM t WHERE a = :a OR b = :b OR c = :a", nil, map[string]any{"a": 1, "b": 2}, false,
+			"SELECT * FROM t WHERE a = ? OR b = ? OR c = ?", []any{1, 2, 1}, false},
+		{"con nombre y array", "SELECT * FROM t WHERE id IN (:ids)", nil, map[string]any{"ids": []any{"a", "b"}}, false,
+			"SELECT * FROM t WHERE id IN (?, ?)", []any{"a", "b"}, false},
+		{"marcadores en cadenas y comentarios", "SELECT '?', ':a', \"?\" -- ? :a\nFROM t /* ? */ WHERE a = ?", []any{1}, nil, false,
+			"SELECT '?', ':a', \"?\" -- ? :a\nFROM t /* ? */ WHERE a = ?", []any{1}, false},
+		{"backslash en mysql", `SELECT 'a\'?' WHERE b = ?`, []any{1}, nil, true,
+			`SELECT 'a\'?' WHERE b = ?`, []any{1}, false},
+		{"numeral en mysql", "SELECT 1 # ?\n WHERE b = ?", []any{1}, nil, true,
+			"SELECT 1 # ?\n WHERE b = ?", []any{1}, false},
+		{":: y := no son marcadores", "SELECT a::text, @x := 1 FROM t WHERE b = ?", []any{1}, nil, false,
+			"SELECT a::text, @x := 1 FROM t WHERE b = ?", []any{1}, false},
+		{"mezcla de marcadores", "SELECT * FROM t WHERE a = ? AND b = :b", []any{1}, map[string]any{"b": 2}, false, "", nil, true},
+		{"faltan posicionales", "SELECT ?, ?", []any{1}, nil, false, "", nil, true},
+		{"sobran posicionales", "SELECT ?", []any{1, 2}, nil, false, "", nil, true},
+		{"falta con nombre", "SELECT :a, :b", nil, map[string]any{"a": 1}, false, "", nil, true},
+		{"sobra con nombre", "SELECT :a", nil, map[string]any{"a": 1, "b": 2}, false, "", nil, true},
+	}
+	for _, caso := range casos {
+		query, params, err := BindParams(caso.query, caso.positional, caso.named, caso.backslash)
+		if caso.falla {
+			if err == nil {
+				t.Errorf("%s: se esperaba un error, obtenido %q %v", caso.nombre, query, params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", caso.nombre, err)
+			continue
+		}
+		if query != caso.esperado || !reflect.DeepEqual(params, caso.params) {
+			t.Errorf("%s:\nobtenido %q %v\nesperado %q %v", caso.nombre, query, params, caso.esperado, caso.params)
+		}
+	}
+}
+
+func TestHasNamedParams(t *testing.T) {
+	casos := []struct {
+		query     string
+		backslash bool
+		esperado  bool
+	}{
+		{"SELECT * FROM t WHERE a = :a", false, true},
+		{"SELECT * FROM t WHERE a = ?", false, false},
+		{"SELECT ':a' -- :b", false, false},
+		{"SELECT a::text", false, false},
+		{"SELECT 1 # :a", true, false},
+	}
+	for _, caso := range casos {
+		if obtenido := HasNamedParams(caso.query, caso.backslash); obtenido != caso.esperado {
+			t.Errorf("%q: obtenido %v, esperado %v", caso.query, obtenido, caso.esperado)
+		}
+	}
+}
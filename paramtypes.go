@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos aceptados en los parámetros tipados {"type": "...", "value": ...}
+// y en las consultas guardadas
+var paramTypes = map[string]struct{}{
+	"string": {}, "int": {}, "int64": {}, "uint64": {}, "float": {}, "float64": {},
+	"decimal": {}, "bool": {}, "date": {}, "datetime": {}, "blob": {}, "any": {},
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+// NormalizeParam convierte un parámetro decodificado con json.Number al valor que
+// se pasa al driver sin perder precisión: los enteros a int64 (o uint64 si no
+// caben), los que tampoco caben en uint64 se pasan como texto y el resto a float64.
+// Los objetos {"type": ..., "value": ...} se convierten al tipo indicado y los
+// arrays se normalizan elemento por elemento para expandirse en IN (...)
+func NormalizeParam(valor any) (any, error) {
+	switch v := valor.(type) {
+	case json.Number:
+		return normalizeNumber(v)
+	case []any:
+		lista := make([]any, len(v))
+		for i, elemento := range v {
+			normalizado, err := NormalizeParam(elemento)
+			if err != nil {
+				return nil, fmt.Errorf("elemento %d: %v", i, err)
+			}
+			lista[i] = normalizado
+		}
+		return lista, nil
+	case map[string]any:
+		tipo, ok := v["type"].(string)
+		if !ok {
+			return nil, fmt.Errorf("los objetos deben tener la forma {\"type\": ..., \"value\": ...}")
+		}
+		for campo := range v {
+			if campo != "type" && campo != "value" {
+				return nil, fmt.Errorf("campo '%s' no permitido en un parámetro tipado", campo)
+			}
+		}
+		if !In(paramTypes, tipo) {
+			return nil, fmt.Errorf("tipo '%s' no soportado, use uno de: %s", tipo, strings.Join(sortedKeys(paramTypes), ", "))
+		}
+		return ConvertParam(tipo, v["value"])
+	}
+	return valor, nil
+}
+
+// normalizeParams normaliza una lista de parámetros, los errores indican la posición
+func normalizeParams(params []any) ([]any, error) {
+	for i, valor := range params {
+		normalizado, err := NormalizeParam(valor)
+		if err != nil {
+			return nil, fmt.Errorf("parámetro %d: %v", i, err)
+		}
+		params[i] = normalizado
+	}
+	return params, nil
+}
+
+func normalizeNumber(n json.Number) (any, error) {
+	texto := n.String()
+	if !strings.ContainsAny(texto, ".eE") {
+		if i, err := strconv.ParseInt(texto, 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(texto, 10, 64); err == nil {
+			return u, nil
+		}
+		// entero mayor que uint64, la base de datos lo convierte desde el texto
+		return texto, nil
+	}
+	return n.Float64()
+}
+
+// ConvertParam convierte valor al tipo indicado, null se mantiene como NULL
+func ConvertParam(tipo string, valor any) (any, error) {
+	if valor == nil {
+		return nil, nil
+	}
+	switch tipo {
+	case "string":
+		if s, ok := valor.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("se esperaba string")
+	case "int", "int64":
+		if texto, ok := numberText(valor); ok {
+			if n, err := strconv.ParseInt(texto, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba un número entero de 64 bits")
+	case "uint64":
+		if texto, ok := numberText(valor); ok {
+			if n, err := strconv.ParseUint(texto, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba un número entero sin signo de 64 bits")
+	case "float", "float64":
+		if texto, ok := numberText(valor); ok {
+			if n, err := strconv.ParseFloat(texto, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba un número")
+	case "decimal":
+		// se pasa como texto para que la base de datos lo convierta sin redondeo
+		if texto, ok := numberText(valor); ok && decimalPattern.MatchString(texto) {
+			return texto, nil
+		}
+		return nil, fmt.Errorf("se esperaba un decimal como \"123.45\"")
+	case "bool":
+		if b, ok := valor.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("se esperaba bool")
+	case "date":
+		if s, ok := valor.(string); ok {
+			if fecha, err := time.Parse(dateLayout, s); err == nil {
+				return fecha.Format(dateLayout), nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba una fecha con formato YYYY-MM-DD")
+	case "datetime":
+		if s, ok := valor.(string); ok {
+			if fecha, err := parseDatetime(s); err == nil {
+				return fecha.Format(datetimeLayout), nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba una fecha con formato RFC 3339 o YYYY-MM-DD HH:MM:SS")
+	case "blob":
+		if s, ok := valor.(string); ok {
+			if datos, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return datos, nil
+			}
+		}
+		return nil, fmt.Errorf("se esperaba un blob codificado en base64")
+	}
+	return NormalizeParam(valor)
+}
+
+// numberText devuelve el texto de un número enviado como número JSON o como string
+func numberText(valor any) (string, bool) {
+	switch v := valor.(type) {
+	case json.Number:
+		return v.String(), true
+	case string:
+		return strings.TrimSpace(v), true
+	}
+	return "", false
+}
+
+// parseDatetime acepta RFC 3339 (se convierte a UTC) o fecha y hora sin zona
+func parseDatetime(s string) (time.Time, error) {
+	if fecha, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return fecha.UTC(), nil
+	}
+	return time.Parse(datetimeLayout, s)
+}
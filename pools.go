@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver es el driver sqlite3 con SQLITE_LIMIT_ATTACHED en 0: aunque una
+// sentencia pase el control de sqlguard.go, ATTACH DATABASE no puede abrir
+// archivos fuera de la carpeta de datos
+const sqliteDriver = "sqlite3_noattach"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+			return nil
+		},
+	})
+}
+
+// poolKey identifica un pool por tipo de base de datos y dsn (o archivo en sqlite3)
+type poolKey struct {
+	dbtype string
+	dsn    string
+}
+
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+type PoolRegistry struct {
+	mu     sync.Mutex
+	config PoolConfig
+	pools  map[poolKey]*sql.DB
+}
+
+var pools = NewPoolRegistry(PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 5 * time.Minute,
+	ConnMaxIdleTime: 1 * time.Minute,
+})
+
+func NewPoolRegistry(config PoolConfig) *PoolRegistry {
+	return &PoolRegistry{
+		config: config,
+		pools:  make(map[poolKey]*sql.DB),
+	}
+}
+
+// milisegundos que una conexión sqlite espera a que se libere un bloqueo
+// antes de devolver SQLITE_BUSY
+const sqliteBusyTimeout = 5000
+
+// LoadPoolConfig lee los límites del pool desde dbsettings.json,
+// los tiempos se expresan en segundos
+func LoadPoolConfig(conf map[string]string) (PoolConfig, error) {
+	config := pools.config
+	campos := []struct {
+		clave string
+		valor func(n int)
+	}{
+		{"maxopenconns", func(n int) { config.MaxOpenConns = n }},
+		{"maxidleconns", func(n int) { config.MaxIdleConns = n }},
+		{"connmaxlifetime", func(n int) { config.ConnMaxLifetime = time.Duration(n) * time.Second }},
+		{"connmaxidletime", func(n int) { config.ConnMaxIdleTime = time.Duration(n) * time.Second }},
+	}
+	for _, campo := range campos {
+		v, ok := conf[campo.clave]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return config, fmt.Errorf("error en %s: '%s' no es un entero mayor o igual a 0", campo.clave, v)
+		}
+		campo.valor(n)
+	}
+	return config, nil
+}
+
+func InitPools(conf map[string]string) error {
+	config, err := LoadPoolConfig(conf)
+	if err != nil {
+		return err
+	}
+	pools.mu.Lock()
+	defer pools.mu.Unlock()
+	pools.config = config
+	return nil
+}
+
+// Get devuelve el pool existente o abre uno nuevo, sql.DB es seguro
+// para usarse desde varias goroutines
+func (p *PoolRegistry) Get(dbtype, dsn string) (*sql.DB, error) {
+	key := poolKey{dbtype: dbtype, dsn: dsn}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if db, ok := p.pools[key]; ok {
+		return db, nil
+	}
+
+	driver := dbtype
+	if dbtype == "sqlite3" {
+		driver = sqliteDriver
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(p.config.MaxOpenConns)
+	db.SetMaxIdleConns(p.config.MaxIdleConns)
+	if dbtype == "sqlite3" && !isReadOnlyDSN(dsn) {
+		// sqlite admite un solo escritor a la vez, con más conexiones las
+		// escrituras solo compiten por el bloqueo y fallan con SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	}
+	db.SetConnMaxLifetime(p.config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.config.ConnMaxIdleTime)
+
+	p.pools[key] = db
+	return db, nil
+}
+
+// CloseAll cierra todos los pools abiertos, se usa al apagar el servidor
+func (p *PoolRegistry) CloseAll() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for key, db := range p.pools {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error cerrando pool %s: %v", key.dbtype, err)
+		}
+		delete(p.pools, key)
+	}
+	return firstErr
+}
+
+func GetPool(dbtype, dsn string) (*sql.DB, error) {
+	return pools.Get(dbtype, dsn)
+}
+
+func ClosePools() error {
+	return pools.CloseAll()
+}
+
+// ReadOnlyDSN abre el archivo sqlite en modo solo lectura y con query_only,
+// las consultas select usan un pool separado con este dsn
+func ReadOnlyDSN(dbName string) string {
+	return fmt.Sprintf("file:%s?mode=ro&_query_only=1&_busy_timeout=%d", dbName, sqliteBusyTimeout)
+}
+
+// WriterDSN es el dsn de las escrituras sqlite, su pool tiene una sola conexión
+func WriterDSN(dbName string) string {
+	return fmt.Sprintf("file:%s?_busy_timeout=%d", dbName, sqliteBusyTimeout)
+}
+
+func isReadOnlyDSN(dsn string) bool {
+	return strings.Contains(dsn, "mode=ro")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredParam declara un parámetro de una consulta guardada
+type StoredParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // uno de paramTypes, con [] para arrays
+	Optional bool   `json:"optional"`
+	Default  any    `json:"default"`
+}
+
+// StoredQuery es una consulta del catálogo, los parámetros se pasan por nombre a
+// los marcadores :nombre de dbquery o en el orden en que están declarados a los ?
+type StoredQuery struct {
+	DbType    string        `json:"dbtype"`
+	Dbname    string        `json:"dbname"`
+	Querytype string        `json:"querytype"`
+	Dbquery   string        `json:"dbquery"`
+	Params    []StoredParam `json:"params"`
+}
+
+// QueryCatalog carga queries.json y lo vuelve a leer cuando el archivo cambia
+type QueryCatalog struct {
+	fileName string
+
+	mu      sync.Mutex
+	queries map[string]StoredQuery
+	modTime time.Time
+}
+
+const queryCatalogFile = "queries.json"
+
+func NewQueryCatalog(fileName string) (*QueryCatalog, error) {
+	catalog := &QueryCatalog{fileName: fileName, queries: map[string]StoredQuery{}}
+	if err := catalog.reload(); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// reload lee el archivo si cambió desde la última carga, si no existe el catálogo queda vacío
+func (q *QueryCatalog) reload() error {
+	info, err := os.Stat(q.fileName)
+	if os.IsNotExist(err) {
+		q.queries = map[string]StoredQuery{}
+		q.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(q.modTime) {
+		return nil
+	}
+
+	dat, err := os.ReadFile(q.fileName)
+	if err != nil {
+		return err
+	}
+	var queries map[string]StoredQuery
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.UseNumber()
+	if err := dec.Decode(&queries); err != nil {
+		return fmt.Errorf("error leyendo %s: %v", q.fileName, err)
+	}
+	for nombre, consulta := range queries {
+		for _, param := range consulta.Params {
+			if tipo := strings.TrimSuffix(param.Type, "[]"); tipo != "" && !In(paramTypes, tipo) {
+				return fmt.Errorf("la consulta %s de %s declara el tipo '%s' en el parámetro %s", nombre, q.fileName, param.Type, param.Name)
+			}
+		}
+	}
+	q.queries = queries
+	q.modTime = info.ModTime()
+	return nil
+}
+
+// Get devuelve la consulta por nombre recargando el catálogo si el archivo cambió,
+// si la recarga falla se sigue usando la última versión válida
+func (q *QueryCatalog) Get(nombre string) (StoredQuery, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.reload(); err != nil {
+		log.Printf("error recargando %s, se usa la versión anterior: %v", q.fileName, err)
+	}
+	consulta, ok := q.queries[nombre]
+	return consulta, ok
+}
+
+// Resolve completa la solicitud con la consulta guardada y convierte los
+// parámetros por nombre en la lista posicional que espera dbquery
+func (q *QueryCatalog) Resolve(consulta *Consulta) []FieldError {
+	guardada, ok := q.Get(consulta.Query)
+	if !ok {
+		return []FieldError{{Field: "query", Message: fmt.Sprintf("la consulta '%s' no existe", consulta.Query)}}
+	}
+	if consulta.Dbquery != "" || len(consulta.Params) > 0 {
+		return []FieldError{{Field: "query", Message: "con query los parámetros se envían como objeto en params y no se admite dbquery"}}
+	}
+
+	var errores []FieldError
+	declarados := make(map[string]struct{}, len(guardada.Params))
+	params := make([]any, 0, len(guardada.Params))
+	valores := make(map[string]any, len(guardada.Params))
+	for _, param := range guardada.Params {
+		declarados[param.Name] = struct{}{}
+		valor, enviado := consulta.NamedParams[param.Name]
+		if !enviado || valor == nil {
+			if !param.Optional {
+				errores = append(errores, FieldError{Field: "params." + param.Name, Message: "campo requerido"})
+				continue
+			}
+			valor = param.Default
+		}
+		convertido, err := convertStoredParam(param.Type, valor)
+		if err != nil {
+			errores = append(errores, FieldError{Field: "params." + param.Name, Message: err.Error()})
+			continue
+		}
+		params = append(params, convertido)
+		valores[param.Name] = convertido
+	}
+
+	var desconocidos []string
+	for nombre := range consulta.NamedParams {
+		if _, ok := declarados[nombre]; !ok {
+			desconocidos = append(desconocidos, nombre)
+		}
+	}
+	sort.Strings(desconocidos)
+	for _, nombre := range desconocidos {
+		errores = append(errores, FieldError{Field: "params." + nombre, Message: "parámetro no declarado en la consulta"})
+	}
+	if len(errores) > 0 {
+		return errores
+	}
+
+	consulta.DbType = guardada.DbType
+	if guardada.Dbname != "" {
+		consulta.Dbname = guardada.Dbname
+	}
+	consulta.Querytype = guardada.Querytype
+	consulta.Dbquery = guardada.Dbquery
+	// la consulta guardada puede usar marcadores ? en el orden declarado o :nombre
+	if HasNamedParams(guardada.Dbquery, guardada.DbType == "mysql") {
+		consulta.Params, consulta.NamedParams = nil, valores
+	} else {
+		consulta.Params, consulta.NamedParams = params, nil
+	}
+	return nil
+}
+
+// convertStoredParam convierte el valor al tipo declarado, los tipos terminados
+// en [] aceptan un array que se expande en la lista de un IN (...)
+func convertStoredParam(tipo string, valor any) (any, error) {
+	if valor == nil {
+		return nil, nil
+	}
+	if elemento, ok := strings.CutSuffix(tipo, "[]"); ok {
+		lista, ok := valor.([]any)
+		if !ok {
+			return nil, fmt.Errorf("se esperaba array")
+		}
+		convertida := make([]any, len(lista))
+		for i, v := range lista {
+			c, err := convertStoredParam(elemento, v)
+			if err != nil {
+				return nil, fmt.Errorf("elemento %d: %v", i, err)
+			}
+			convertida[i] = c
+		}
+		return convertida, nil
+	}
+	return ConvertParam(tipo, valor)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+type Consulta struct {
+	DbType     string           `json:"dbtype" binding:"required,oneof=sqlite3 mysql badgerdb"`
+	Dbname     string           `json:"dbname" binding:"required"`
+	Apikey     string           `json:"apikey"`
+	Querytype  string           `json:"querytype" binding:"required"`
+	Dbquery    string           `json:"dbquery"`
+	Query      string           `json:"query"` // nombre de una consulta guardada en queries.json
+	RawParams  json.RawMessage  `json:"params"`
+	Statements []BatchStatement `json:"statements"`
+	Metadata   bool             `json:"metadata"` // incluye las columnas y sus tipos en los select
+	Stream     bool             `json:"stream"`   // envía las filas del select a medida que se leen
+	Format     string           `json:"format" binding:"omitempty,oneof=json csv ndjson msgpack"`
+	Page       *PageRequest     `json:"page"`
+
+	// params puede ser una lista posicional o un objeto con parámetros por nombre
+	Params      []any          `json:"-"`
+	NamedParams map[string]any `json:"-"`
+}
+
+// FieldError describe un campo inválido de la solicitud
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// querytypes permitidos para cada dbtype
+var querytypes = map[string]map[string]struct{}{
+	"sqlite3":  {"select": {}, "exec": {}, "alter": {}, "batch": {}},
+	"mysql":    {"select": {}, "exec": {}, "alter": {}, "batch": {}},
+	"badgerdb": {"select": {}, "exec": {}, "update": {}, "upsert": {}, "delete": {}, "list": {}, "find": {}, "batch": {}},
+}
+
+func init() {
+	// Usar el nombre JSON del campo en los errores de validación
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+			name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// DecodeConsulta lee el cuerpo JSON de la solicitud sin validarlo, el cuerpo
+// queda guardado en el contexto para poder verificar la firma
+func DecodeConsulta(c *gin.Context) (Consulta, []FieldError) {
+	var consulta Consulta
+	body, err := rawBody(c)
+	if err != nil {
+		return consulta, []FieldError{{Message: err.Error()}}
+	}
+	// los números se decodifican como json.Number para no perder precisión
+	if err := decodeJSON(body, &consulta); err != nil {
+		return consulta, bindErrors(err)
+	}
+	if err := consulta.decodeParams(); err != nil {
+		return consulta, []FieldError{{Field: "params", Message: err.Error()}}
+	}
+	return consulta, nil
+}
+
+// Prepare resuelve la consulta guardada si se envió query, valida la solicitud
+// y enlaza los parámetros, devolviendo un error por cada campo inválido
+func (c *Consulta) Prepare(catalog *QueryCatalog) []FieldError {
+	if c.Query != "" {
+		if errores := catalog.Resolve(c); len(errores) > 0 {
+			return errores
+		}
+	}
+	if err := binding.Validator.ValidateStruct(c); err != nil {
+		return bindErrors(err)
+	}
+	if errores := c.Validate(); len(errores) > 0 {
+		return errores
+	}
+	if c.DbType == "badgerdb" {
+		if c.NamedParams != nil {
+			return []FieldError{{Field: "params", Message: "badgerdb no admite parámetros por nombre"}}
+		}
+		return nil
+	}
+	if errores := c.normalizeQueryParams(); len(errores) > 0 {
+		return errores
+	}
+	return c.bindQueryParams()
+}
+
+func (c *Consulta) decodeParams() error {
+	raw := strings.TrimSpace(string(c.RawParams))
+	switch {
+	case raw == "" || raw == "null":
+		return nil
+	case strings.HasPrefix(raw, "["):
+		return decodeJSON(c.RawParams, &c.Params)
+	case strings.HasPrefix(raw, "{"):
+		return decodeJSON(c.RawParams, &c.NamedParams)
+	}
+	return fmt.Errorf("se esperaba array u object")
+}
+
+// normalizeQueryParams convierte los números y los parámetros tipados de dbquery
+// y de cada sentencia del lote a los valores que recibe el driver
+func (c *Consulta) normalizeQueryParams() []FieldError {
+	var errores []FieldError
+	if _, err := normalizeParams(c.Params); err != nil {
+		errores = append(errores, FieldError{Field: "params", Message: err.Error()})
+	}
+	for _, nombre := range sortedKeys(c.NamedParams) {
+		normalizado, err := NormalizeParam(c.NamedParams[nombre])
+		if err != nil {
+			errores = append(errores, FieldError{Field: "params." + nombre, Message: err.Error()})
+			continue
+		}
+		c.NamedParams[nombre] = normalizado
+	}
+	for i := range c.Statements {
+		if _, err := normalizeParams(c.Statements[i].Params); err != nil {
+			errores = append(errores, FieldError{Field: fmt.Sprintf("statements[%d].params", i), Message: err.Error()})
+		}
+	}
+	return errores
+}
+
+// decodeJSON decodifica como json.Unmarshal pero con los números como json.Number
+func decodeJSON(data []byte, destino any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(destino); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("contenido adicional después del JSON")
+	}
+	return nil
+}
+
+// Validate comprueba las reglas que dependen de varios campos
+func (c Consulta) Validate() []FieldError {
+	var errores []FieldError
+
+	permitidos := querytypes[c.DbType]
+	if !In(permitidos, c.Querytype) {
+		errores = append(errores, FieldError{
+			Field:   "querytype",
+			Message: fmt.Sprintf("querytype '%s' no soportado para %s, use uno de: %s", c.Querytype, c.DbType, strings.Join(sortedKeys(permitidos), ", ")),
+		})
+		return errores
+	}
+
+	if c.Page != nil {
+		if c.Querytype != "select" && c.Querytype != "list" && c.Querytype != "find" || c.DbType == "badgerdb" && c.Querytype == "select" {
+			errores = append(errores, FieldError{Field: "page", Message: fmt.Sprintf("querytype '%s' no admite paginación", c.Querytype)})
+		}
+		errores = append(errores, c.Page.Validate(c.DbType)...)
+	}
+
+	switch c.Querytype {
+	case "list":
+	case "batch":
+		if len(c.Statements) == 0 {
+			errores = append(errores, FieldError{Field: "statements", Message: "el lote no contiene sentencias"})
+		}
+		for i, sentencia := range c.Statements {
+			if sentencia.Dbquery == "" {
+				errores = append(errores, FieldError{Field: fmt.Sprintf("statements[%d].dbquery", i), Message: "campo requerido"})
+			}
+		}
+	default:
+		if c.Dbquery == "" {
+			errores = append(errores, FieldError{Field: "dbquery", Message: "campo requerido"})
+		}
+	}
+	return errores
+}
+
+func bindErrors(err error) []FieldError {
+	var validacion validator.ValidationErrors
+	if errors.As(err, &validacion) {
+		errores := make([]FieldError, 0, len(validacion))
+		for _, fe := range validacion {
+			errores = append(errores, FieldError{Field: fe.Field(), Message: validationMessage(fe)})
+		}
+		return errores
+	}
+
+	var tipo *json.UnmarshalTypeError
+	if errors.As(err, &tipo) {
+		return []FieldError{{
+			Field:   tipo.Field,
+			Message: fmt.Sprintf("se esperaba %s y se recibió %s", jsonKind(tipo.Type), tipo.Value),
+		}}
+	}
+
+	var sintaxis *json.SyntaxError
+	if errors.As(err, &sintaxis) {
+		return []FieldError{{Message: fmt.Sprintf("JSON inválido en la posición %d: %v", sintaxis.Offset, err)}}
+	}
+	return []FieldError{{Message: err.Error()}}
+}
+
+// jsonKind traduce un tipo de Go al nombre del tipo JSON equivalente
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return t.String()
+	}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "campo requerido"
+	case "oneof":
+		return fmt.Sprintf("valor '%v' no soportado, use uno de: %s", fe.Value(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("no cumple la regla %s", fe.Tag())
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
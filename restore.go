@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/klauspost/compress/zstd"
+)
+
+// cada cuántas sentencias se informa el progreso de una restauración
+const restoreProgressEvery = 500
+
+// RestoreOptions son las opciones de Restore
+type RestoreOptions struct {
+	DryRun          bool // solo lee y separa las sentencias, no se conecta a la base
+	ContinueOnError bool // registra el error y sigue con la sentencia siguiente
+	// Progress se llama cada restoreProgressEvery sentencias, puede ser nil
+	Progress func(RestoreProgress)
+}
+
+// RestoreProgress es el avance de una restauración
+type RestoreProgress struct {
+	Statements int   `json:"statements"` // sentencias leídas
+	Executed   int   `json:"executed"`
+	Skipped    int   `json:"skipped"` // sentencias que no aplican al destino (SET, USE, rutinas en SQLite, ...)
+	Failed     int   `json:"failed"`
+	Bytes      int64 `json:"bytes"` // bytes leídos del archivo
+	Size       int64 `json:"size"`  // tamaño del archivo
+}
+
+// RestoreError es el error de una sentencia
+type RestoreError struct {
+	Statement int    `json:"statement"` // número de sentencia, desde 1
+	Line      int    `json:"line"`      // línea del archivo donde empieza
+	Text      string `json:"text"`      // sentencia abreviada
+	Message   string `json:"message"`
+}
+
+// RestoreResult es el resultado de una restauración
+type RestoreResult struct {
+	RestoreProgress
+	DryRun bool           `json:"dryRun"`
+	Errors []RestoreError `json:"errors"`
+}
+
+// cantidad máxima de errores que se devuelven con ContinueOnError
+const restoreMaxErrors = 100
+
+// BackupPath valida el nombre de un respaldo y devuelve su ruta en la carpeta
+// de respaldos o en sus subcarpetas sqlite3 y badgerdb, no se admiten rutas
+func BackupPath(dir, nombre string) (string, error) {
+	if nombre == "" || filepath.Base(nombre) != nombre || strings.HasPrefix(nombre, ".") {
+		return "", NewAPIError(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("nombre de respaldo '%s' inválido", nombre))
+	}
+	for _, carpeta := range []string{dir, filepath.Join(dir, "sqlite3"), filepath.Join(dir, "badgerdb")} {
+		ruta := filepath.Join(carpeta, nombre)
+		if info, err := os.Stat(ruta); err == nil && info.Mode().IsRegular() {
+			return ruta, nil
+		}
+	}
+	return "", NewAPIError(http.StatusNotFound, CodeDbNotFound, fmt.Sprintf("el respaldo '%s' no existe", nombre))
+}
+
+// countingReader cuenta los bytes leídos del archivo, antes de descomprimir
+type countingReader struct {
+	r     io.Reader
+	bytes int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// openBackupFile abre un respaldo y lo descomprime según su extensión (.gz o .zst)
+func openBackupFile(ruta string) (io.Reader, *countingReader, func(), error) {
+	archivo, err := os.Open(ruta)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	contador := &countingReader{r: archivo}
+	switch filepath.Ext(ruta) {
+	case compressionExtensions[CompressionGzip]:
+		gz, err := gzip.NewReader(contador)
+		if err != nil {
+			archivo.Close()
+			return nil, nil, nil, fmt.Errorf("error leyendo %s: %v", ruta, err)
+		}
+		return gz, contador, func() { archivo.Close() }, nil
+	case compressionExtensions[CompressionZstd]:
+		zr, err := zstd.NewReader(contador)
+		if err != nil {
+			archivo.Close()
+			return nil, nil, nil, fmt.Errorf("error leyendo %s: %v", ruta, err)
+		}
+		return zr, contador, func() {
+			zr.Close()
+			archivo.Close()
+		}, nil
+	}
+	return contador, contador, func() { archivo.Close() }, nil
+}
+
+// dumpReader lee las sentencias de un script SQL de a una, sin cargarlo entero.
+// Como el cliente mysql interpreta "DELIMITER x" al inicio de una línea, que
+// cambia el separador de sentencias, y respeta cadenas, identificadores entre
+// comillas y comentarios. Los comentarios de línea se descartan y los de
+// bloque se mantienen, /*! ... */ se ejecuta en MySQL
+type dumpReader struct {
+	r         *bufio.Reader
+	separador string
+	linea     int
+	pendiente string // resto de la línea después del último separador
+}
+
+func newDumpReader(r io.Reader) *dumpReader {
+	return &dumpReader{r: bufio.NewReaderSize(r, 1<<20), separador: ";"}
+}
+
+func (d *dumpReader) readLine() (string, error) {
+	if d.pendiente != "" {
+		linea := d.pendiente
+		d.pendiente = ""
+		return linea, nil
+	}
+	linea, err := d.r.ReadString('\n')
+	if linea != "" {
+		d.linea++
+		return linea, nil
+	}
+	return "", err
+}
+
+// Next devuelve la sentencia siguiente sin el separador y la línea donde
+// empieza; al terminar el archivo devuelve io.EOF
+func (d *dumpReader) Next() (string, int, error) {
+	var sb strings.Builder
+	inicio := 0        // línea del primer carácter de la sentencia
+	comilla := byte(0) // comilla abierta: ' " o `
+	bloque := false    // dentro de /* ... */
+	for {
+		linea, err := d.readLine()
+		if err != nil {
+			if err != io.EOF {
+				return "", 0, err
+			}
+			if texto := strings.TrimSpace(sb.String()); texto != "" {
+				return texto, inicio, nil
+			}
+			return "", 0, io.EOF
+		}
+
+		if inicio == 0 && comilla == 0 && !bloque {
+			campos := strings.Fields(linea)
+			if len(campos) == 2 && strings.EqualFold(campos[0], "DELIMITER") {
+				d.separador = campos[1]
+				continue
+			}
+		}
+
+		for i := 0; i < len(linea); i++ {
+			b := linea[i]
+			switch {
+			case comilla != 0:
+				if b == '\\' && comilla != '`' && i+1 < len(linea) {
+					sb.WriteString(linea[i : i+2])
+					i++
+					continue
+				}
+				if b == comilla {
+					comilla = 0
+				}
+			case bloque:
+				if strings.HasPrefix(linea[i:], "*/") {
+					bloque = false
+					sb.WriteString("*/")
+					i++
+					continue
+				}
+			case strings.HasPrefix(linea[i:], d.separador):
+				d.pendiente = linea[i+len(d.separador):]
+				if strings.TrimSpace(d.pendiente) == "" {
+					d.pendiente = ""
+				}
+				if inicio > 0 {
+					return strings.TrimSpace(sb.String()), inicio, nil
+				}
+				sb.Reset()
+				i = len(linea)
+				continue
+			case b == '\'' || b == '"' || b == '`':
+				comilla = b
+			case strings.HasPrefix(linea[i:], "/*"):
+				if inicio == 0 {
+					inicio = d.linea
+				}
+				bloque = true
+				sb.WriteString("/*")
+				i++
+				continue
+			case b == '#' || isDashComment(linea[i:]):
+				sb.WriteByte('\n')
+				i = len(linea)
+				continue
+			}
+			if inicio == 0 && b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+				inicio = d.linea
+			}
+			sb.WriteByte(b)
+		}
+	}
+}
+
+// isDashComment indica si el texto empieza con un comentario "-- " de MySQL
+func isDashComment(texto string) bool {
+	if !strings.HasPrefix(texto, "--") {
+		return false
+	}
+	return len(texto) == 2 || strings.ContainsRune(" \t\r\n", rune(texto[2]))
+}
+
+// restoreTarget ejecuta las sentencias del respaldo en la base de destino
+type restoreTarget interface {
+	// Exec ejecuta una sentencia, skip indica que no aplica a este destino
+	Exec(ctx context.Context, sentencia string) (skip bool, err error)
+	// Close termina la restauración, ok indica si se completó
+	Close(ok bool) error
+}
+
+// Restore ejecuta un respaldo de createBackup sentencia por sentencia en el
+// destino. Sin ContinueOnError se detiene en el primer error
+func Restore(ctx context.Context, ruta string, destino restoreTarget, opciones RestoreOptions) (RestoreResult, error) {
+	resultado := RestoreResult{DryRun: opciones.DryRun, Errors: []RestoreError{}}
+	if info, err := os.Stat(ruta); err == nil {
+		resultado.Size = info.Size()
+	}
+	lector, contador, cerrar, err := openBackupFile(ruta)
+	if err != nil {
+		return resultado, err
+	}
+	defer cerrar()
+
+	// si la restauración no llega al final se descartan los cambios
+	completo := false
+	defer func() {
+		if !completo {
+			destino.Close(false)
+		}
+	}()
+
+	dump := newDumpReader(lector)
+	for {
+		if err := ctx.Err(); err != nil {
+			return resultado, err
+		}
+		sentencia, linea, err := dump.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return resultado, fmt.Errorf("error leyendo el respaldo: %v", err)
+		}
+		resultado.Statements++
+		resultado.Bytes = contador.bytes
+
+		skip, err := destino.Exec(ctx, sentencia)
+		switch {
+		case err != nil:
+			resultado.Failed++
+			if len(resultado.Errors) < restoreMaxErrors {
+				resultado.Errors = append(resultado.Errors, RestoreError{
+					Statement: resultado.Statements,
+					Line:      linea,
+					Text:      abbreviate(sentencia),
+					Message:   err.Error(),
+				})
+			}
+			if !opciones.ContinueOnError {
+				return resultado, fmt.Errorf("error en la sentencia %d (línea %d): %v", resultado.Statements, linea, err)
+			}
+		case skip:
+			resultado.Skipped++
+		default:
+			resultado.Executed++
+		}
+		if opciones.Progress != nil && resultado.Statements%restoreProgressEvery == 0 {
+			opciones.Progress(resultado.RestoreProgress)
+		}
+	}
+	resultado.Bytes = contador.bytes
+	completo = true
+	if err := destino.Close(true); err != nil {
+		return resultado, fmt.Errorf("error terminando la restauración: %v", err)
+	}
+	return resultado, nil
+}
+
+// mysqlRestore restaura en una base MySQL, que se crea si no existe. Todas las
+// sentencias van por una misma conexión para que valgan los SET del respaldo;
+// CREATE DATABASE y USE se omiten para restaurar en la base indicada
+type mysqlRestore struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func newMysqlRestore(ctx context.Context, conf map[string]string, base string) (*mysqlRestore, error) {
+	db, err := sql.Open("mysql", Connection(conf["dbuser"], conf["dbpass"], conf["dbhost"], conf["dbport"], ""))
+	if err != nil {
+		return nil, fmt.Errorf("error conectando a la base de datos: %v", err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error conectando a la base de datos: %v", err)
+	}
+	for _, sentencia := range []string{"CREATE DATABASE IF NOT EXISTS " + quoteIdent(base), "USE " + quoteIdent(base)} {
+		if _, err := conn.ExecContext(ctx, sentencia); err != nil {
+			conn.Close()
+			db.Close()
+			return nil, err
+		}
+	}
+	return &mysqlRestore{db: db, conn: conn}, nil
+}
+
+// mysqlSkipped indica si la sentencia se omite al restaurar en MySQL
+func mysqlSkipped(sentencia string) bool {
+	palabras, _ := sqlWords(sentencia, true)
+	if len(palabras) == 0 || palabras[0] == "USE" {
+		return true
+	}
+	return len(palabras) > 1 && palabras[0] == "CREATE" && (palabras[1] == "DATABASE" || palabras[1] == "SCHEMA")
+}
+
+func (m *mysqlRestore) Exec(ctx context.Context, sentencia string) (bool, error) {
+	if mysqlSkipped(sentencia) {
+		return true, nil
+	}
+	_, err := m.conn.ExecContext(ctx, sentencia)
+	return false, err
+}
+
+func (m *mysqlRestore) Close(ok bool) error {
+	m.conn.Close()
+	return m.db.Close()
+}
+
+// dryRunTarget no ejecuta nada, con SQLite traduce las sentencias para
+// informar las que se omitirían
+type dryRunTarget struct {
+	sqlite *sqliteTranslator
+}
+
+func (d dryRunTarget) Exec(ctx context.Context, sentencia string) (bool, error) {
+	if d.sqlite != nil {
+		traducidas, err := d.sqlite.Translate(sentencia)
+		return len(traducidas) == 0 && err == nil, err
+	}
+	return mysqlSkipped(sentencia), nil
+}
+
+func (d dryRunTarget) Close(ok bool) error {
+	return nil
+}
+
+// RestoreRequest es la solicitud de POST /admin/restore
+type RestoreRequest struct {
+	Apikey  string `json:"apikey"`
+	File    string `json:"file" binding:"required"` // nombre del respaldo en la carpeta de respaldos
+	DbType  string `json:"dbtype" binding:"required,oneof=mysql sqlite3 badgerdb"`
+	Dbname  string `json:"dbname" binding:"required"`
+	DryRun  bool   `json:"dryrun"`
+	OnError string `json:"onerror" binding:"omitempty,oneof=stop continue"`
+}
+
+// newRestoreTarget abre el destino de la restauración, en dry-run no se conecta
+func newRestoreTarget(ctx context.Context, conf map[string]string, dbtype, dbname string, dryRun bool) (restoreTarget, error) {
+	if dbtype == "sqlite3" {
+		ruta, err := ResolveDbPath(dbname)
+		if err != nil {
+			return nil, err
+		}
+		if dryRun {
+			return dryRunTarget{sqlite: newSqliteTranslator()}, nil
+		}
+		return newSqliteRestore(ctx, ruta)
+	}
+	if err := ValidateMysqlName(dbname); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return dryRunTarget{}, nil
+	}
+	return newMysqlRestore(ctx, conf, dbname)
+}
+
+// RestoreHandler atiende POST /admin/restore: restaura un respaldo de la carpeta
+// de respaldos en una base MySQL o en una base SQLite nueva, o un respaldo de
+// una base sqlite3 o badgerdb con RestoreSnapshot. Requiere una apikey con
+// admin. La respuesta es NDJSON: una línea {"progress": ...} cada
+// restoreProgressEvery sentencias y una última línea con el estado y el resultado
+func RestoreHandler(auth *Authenticator, conf map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var solicitud RestoreRequest
+		body, err := rawBody(c)
+		if err == nil {
+			err = decodeJSON(body, &solicitud)
+		}
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&solicitud)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "code": CodeInvalidRequest, "message": "solicitud inválida", "errors": bindErrors(err)})
+			return
+		}
+		key, err := auth.Authenticate(c, solicitud.Apikey)
+		if err != nil {
+			RespondError(c, err)
+			return
+		}
+		if err := key.AuthorizeAdmin(solicitud.DbType, solicitud.Dbname); err != nil {
+			RespondError(c, err)
+			return
+		}
+		ruta, err := BackupPath(defaultBackupDir, solicitud.File)
+		if err != nil {
+			RespondError(c, err)
+			return
+		}
+		ctx := c.Request.Context()
+		if SnapshotType(ruta) != "" || solicitud.DbType == "badgerdb" {
+			if solicitud.DryRun || solicitud.OnError == "continue" {
+				RespondError(c, NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "dryrun y onerror solo se usan con respaldos SQL"))
+				return
+			}
+			if err := RestoreSnapshot(ctx, ruta, solicitud.DbType, solicitud.Dbname); err != nil {
+				RespondError(c, err)
+				return
+			}
+			c.Header("Content-Type", formatContentTypes[FormatNDJSON])
+			c.Status(http.StatusOK)
+			json.NewEncoder(c.Writer).Encode(gin.H{"status": "success", "result": gin.H{"file": solicitud.File, "dbname": solicitud.Dbname}})
+			return
+		}
+		destino, err := newRestoreTarget(ctx, conf, solicitud.DbType, solicitud.Dbname, solicitud.DryRun)
+		if err != nil {
+			RespondError(c, err)
+			return
+		}
+
+		c.Header("Content-Type", formatContentTypes[FormatNDJSON])
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		opciones := RestoreOptions{
+			DryRun:          solicitud.DryRun,
+			ContinueOnError: solicitud.OnError == "continue",
+			Progress: func(avance RestoreProgress) {
+				enc.Encode(gin.H{"progress": avance})
+				c.Writer.Flush()
+			},
+		}
+		resultado, err := Restore(ctx, ruta, destino, opciones)
+		estado := gin.H{"status": "success", "result": resultado}
+		if err != nil {
+			c.Error(err)
+			estado = streamError(err)
+			estado["result"] = resultado
+		}
+		enc.Encode(estado)
+		c.Writer.Flush()
+	}
+}
+
+// RunRestoreCommand atiende "micro_db_server restore [-dry-run] [-continue]
+// <archivo> <mysql|sqlite3|badgerdb> <dbname>", el progreso se imprime en la
+// consola. Los respaldos de bases sqlite3 y badgerdb se restauran con RestoreSnapshot
+func RunRestoreCommand(args []string, conf map[string]string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "solo lee el respaldo, no modifica la base")
+	continuar := flags.Bool("continue", false, "sigue con la sentencia siguiente ante un error")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 3 || (flags.Arg(1) != "mysql" && flags.Arg(1) != "sqlite3" && flags.Arg(1) != "badgerdb") {
+		return fmt.Errorf("uso: restore [-dry-run] [-continue] <archivo> <mysql|sqlite3|badgerdb> <dbname>")
+	}
+	ruta, dbtype, dbname := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if SnapshotType(ruta) != "" || dbtype == "badgerdb" {
+		if *dryRun || *continuar {
+			return fmt.Errorf("-dry-run y -continue solo se usan con respaldos SQL")
+		}
+		if err := RestoreSnapshot(ctx, ruta, dbtype, dbname); err != nil {
+			return err
+		}
+		fmt.Println("Base restaurada:", dbname)
+		return nil
+	}
+	destino, err := newRestoreTarget(ctx, conf, dbtype, dbname, *dryRun)
+	if err != nil {
+		return err
+	}
+	resultado, err := Restore(ctx, ruta, destino, RestoreOptions{
+		DryRun:          *dryRun,
+		ContinueOnError: *continuar,
+		Progress: func(avance RestoreProgress) {
+			fmt.Printf("%d sentencias, %d de %d bytes\n", avance.Statements, avance.Bytes, avance.Size)
+		},
+	})
+	fmt.Printf("Sentencias: %d, ejecutadas: %d, omitidas: %d, con error: %d\n",
+		resultado.Statements, resultado.Executed, resultado.Skipped, resultado.Failed)
+	for _, e := range resultado.Errors {
+		fmt.Printf("  sentencia %d (línea %d): %s\n    %s\n", e.Statement, e.Line, e.Message, e.Text)
+	}
+	return err
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpReader(t *testing.T) {
+	type sentencia struct {
+		Texto string
+		Linea int
+	}
+	casos := []struct {
+		nombre   string
+		dump     string
+		esperado []sentencia
+	}{
+		{"simple", "CREATE TABLE t (a INT);\nINSERT INTO t VALUES (1);\n",
+			[]sentencia{{"CREATE TABLE t (a INT)", 1}, {"INSERT INTO t VALUES (1)", 2}}},
+		{"varias en una línea", "SET a=1; SET b=2;\n",
+			[]sentencia{{"SET a=1", 1}, {"SET b=2", 1}}},
+		{"varias líneas", "INSERT INTO t\nVALUES\n(1);\n",
+			[]sentencia{{"INSERT INTO t\nVALUES\n(1)", 1}}},
+		{"separador en cadenas", "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`);\n",
+			[]sentencia{{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`)", 1}}},
+		{"comilla escapada", "INSERT INTO t VALUES ('it\\'s;', 'x''y;');\nSELECT 1;\n",
+			[]sentencia{{"INSERT INTO t VALUES ('it\\'s;', 'x''y;')", 1}, {"SELECT 1", 2}}},
+		{"cadena de varias líneas", "INSERT INTO t VALUES ('a\n;b');\n",
+			[]sentencia{{"INSERT INTO t VALUES ('a\n;b')", 1}}},
+		{"comentarios de línea", "-- MySQL dump\n# otro; comentario\nSELECT 1; -- fin;\n",
+			[]sentencia{{"SELECT 1", 3}}},
+		{"comentario de bloque", "/* a; b */ SELECT 1;\n",
+			[]sentencia{{"/* a; b */ SELECT 1", 1}}},
+		{"comentario condicional", "/*!40101 SET NAMES utf8mb4 */;\n",
+			[]sentencia{{"/*!40101 SET NAMES utf8mb4 */", 1}}},
+		{"DELIMITER ;;", "DELIMITER ;;\nCREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN\n  SET NEW.a = 1;\n  SET NEW.b = ';;';\nEND ;;\nDELIMITER ;\nSELECT 1;\n",
+			[]sentencia{{"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN\n  SET NEW.a = 1;\n  SET NEW.b = ';;';\nEND", 2}, {"SELECT 1", 7}}},
+		{"DELIMITER $$", "delimiter $$\nCREATE PROCEDURE p() BEGIN SELECT 1; END$$\ndelimiter ;\n",
+			[]sentencia{{"CREATE PROCEDURE p() BEGIN SELECT 1; END", 2}}},
+		{"sin separador final", "SELECT 1;\nSELECT 2\n",
+			[]sentencia{{"SELECT 1", 1}, {"SELECT 2", 2}}},
+		{"vacío", "\n\n-- nada\n", nil},
+	}
+	for _, caso := range casos {
+		lector := newDumpReader(strings.NewReader(caso.dump))
+		var obtenido []sentencia
+		for {
+			texto, linea, err := lector.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", caso.nombre, err)
+			}
+			obtenido = append(obtenido, sentencia{texto, linea})
+		}
+		if !reflect.DeepEqual(obtenido, caso.esperado) {
+			t.Errorf("%s:\nobtenido %+v\nesperado %+v", caso.nombre, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestTokenizeMysql(t *testing.T) {
+	casos := []struct {
+		sentencia string
+		esperado  []sqlToken
+	}{
+		{"SELECT `a b`, 'x' FROM t", []sqlToken{{tokWord, "SELECT"}, {tokIdent, "a b"}, {tokSymbol, ","}, {tokString, "x"}, {tokWord, "FROM"}, {tokWord, "t"}}},
+		{`'a\'b\nc' "d""e"`, []sqlToken{{tokString, "a'b\nc"}, {tokString, `d"e`}}},
+		{`'50\%'`, []sqlToken{{tokString, `50\%`}}},
+		{"0x1F X'ab' b'101' 0b11", []sqlToken{{tokHex, "1F"}, {tokHex, "ab"}, {tokBits, "101"}, {tokBits, "11"}}},
+		{"1.5e-3 .5 -2", []sqlToken{{tokNumber, "1.5e-3"}, {tokNumber, ".5"}, {tokSymbol, "-"}, {tokNumber, "2"}}},
+		{"a <=> b -- c\n# d\n/*! e */ >= f", []sqlToken{{tokWord, "a"}, {tokSymbol, "<=>"}, {tokWord, "b"}, {tokSymbol, ">="}, {tokWord, "f"}}},
+		{"_utf8mb4'x' $v", []sqlToken{{tokWord, "_utf8mb4"}, {tokString, "x"}, {tokWord, "$v"}}},
+	}
+	for _, caso := range casos {
+		obtenido, err := tokenizeMysql(caso.sentencia)
+		if err != nil {
+			t.Errorf("%q: %v", caso.sentencia, err)
+			continue
+		}
+		if !reflect.DeepEqual(obtenido, caso.esperado) {
+			t.Errorf("%q:\nobtenido %v\nesperado %v", caso.sentencia, obtenido, caso.esperado)
+		}
+	}
+	for _, invalida := range []string{"'sin cerrar", "/* sin cerrar", "x'ab"} {
+		if _, err := tokenizeMysql(invalida); err == nil {
+			t.Errorf("%q: se esperaba un error", invalida)
+		}
+	}
+}
+
+func TestSqliteTranslator(t *testing.T) {
+	// las sentencias se traducen en orden con el mismo traductor, los INSERT
+	// usan las columnas de los CREATE TABLE anteriores
+	casos := []struct {
+		sentencia string
+		esperado  []string
+	}{
+		{"SET NAMES utf8mb4", nil},
+		{"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */", nil},
+		{"LOCK TABLES `t` WRITE", nil},
+		{"DROP TABLE IF EXISTS `t`", []string{`DROP TABLE IF EXISTS "t"`}},
+		{"CREATE TABLE `t` (\n  `id` int unsigned NOT NULL AUTO_INCREMENT,\n  `nombre` varchar(50) COLLATE utf8mb4_bin DEFAULT 'x',\n" +
+			"  `activo` bit(1) DEFAULT b'1',\n  `creado` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+			"  PRIMARY KEY (`id`),\n  UNIQUE KEY `u_nombre` (`nombre`),\n  KEY `i_creado` (`creado`),\n  FULLTEXT KEY `f` (`nombre`)\n" +
+			") ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4",
+			[]string{
+				"CREATE TABLE \"t\" (\n  \"id\" INTEGER NOT NULL,\n  \"nombre\" VARCHAR(50) DEFAULT 'x',\n  \"activo\" INTEGER DEFAULT 1,\n" +
+					"  \"creado\" DATETIME DEFAULT CURRENT_TIMESTAMP,\n  PRIMARY KEY (\"id\"),\n  UNIQUE (\"nombre\")\n)",
+				`CREATE INDEX "t_i_creado" ON "t" ("creado")`,
+			}},
+		{"INSERT INTO `t` VALUES (1,'it\\'s',0x01,'2026-10-18 03:00:00'),(2,_utf8mb4'b',0x00,NULL)",
+			[]string{`INSERT INTO "t" VALUES (1, 'it''s', 1, '2026-10-18 03:00:00'), (2, 'b', 0, NULL)`}},
+		{"INSERT IGNORE INTO `t` (`activo`,`id`) VALUES (0x01,3)",
+			[]string{`INSERT OR IGNORE INTO "t" ("activo", "id") VALUES (1, 3)`}},
+		{"INSERT INTO `b` VALUES (X'00ff','a\\0b')", []string{`INSERT INTO "b" VALUES (X'00FF', CAST(X'610062' AS TEXT))`}},
+		{"ALTER TABLE `t` DISABLE KEYS", nil},
+		{"CREATE DEFINER=`root`@`localhost` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.id = 1", nil},
+		{"CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v` AS select `t`.`id` AS `id` from `t` WITH CASCADED CHECK OPTION",
+			[]string{`CREATE VIEW "v" AS select "t"."id" AS "id" from "t"`}},
+		{"DROP PROCEDURE IF EXISTS p", nil},
+		{"UNLOCK TABLES", nil},
+	}
+	traductor := newSqliteTranslator()
+	for _, caso := range casos {
+		obtenido, err := traductor.Translate(caso.sentencia)
+		if err != nil {
+			t.Errorf("%q: %v", caso.sentencia, err)
+			continue
+		}
+		if !reflect.DeepEqual(obtenido, caso.esperado) {
+			t.Errorf("%q:\nobtenido %q\nesperado %q", caso.sentencia, obtenido, caso.esperado)
+		}
+	}
+}
+
+// restoreTargetPrueba registra las sentencias y falla donde se le indique
+type restoreTargetPrueba struct {
+	sentencias []string
+	falla      string // Exec falla con las sentencias que contienen este texto
+	errCierre  error
+	cierres    []bool
+}
+
+func (r *restoreTargetPrueba) Exec(ctx context.Context, sentencia string) (bool, error) {
+	if strings.HasPrefix(sentencia, "SET ") {
+		return true, nil
+	}
+	if r.falla != "" && strings.Contains(sentencia, r.falla) {
+		return false, errors.New("falla " + r.falla)
+	}
+	r.sentencias = append(r.sentencias, sentencia)
+	return false, nil
+}
+
+func (r *restoreTargetPrueba) Close(ok bool) error {
+	r.cierres = append(r.cierres, ok)
+	return r.errCierre
+}
+
+func writeDump(t *testing.T, nombre, contenido string) string {
+	t.Helper()
+	ruta := filepath.Join(t.TempDir(), nombre)
+	var datos bytes.Buffer
+	if strings.HasSuffix(nombre, ".gz") {
+		gz := gzip.NewWriter(&datos)
+		gz.Write([]byte(contenido))
+		gz.Close()
+	} else {
+		datos.WriteString(contenido)
+	}
+	if err := os.WriteFile(ruta, datos.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ruta
+}
+
+func TestRestore(t *testing.T) {
+	const dump = "SET NAMES utf8mb4;\nINSERT INTO t VALUES (1);\nINSERT INTO t VALUES (2);\nINSERT INTO t VALUES (3);\n"
+	casos := []struct {
+		nombre     string
+		archivo    string
+		destino    *restoreTargetPrueba
+		opciones   RestoreOptions
+		falla      bool
+		leidas     int
+		ejecutadas int
+		omitidas   int
+		fallidas   int
+		cierres    []bool
+	}{
+		{"completa", "a.sql", &restoreTargetPrueba{}, RestoreOptions{}, false, 4, 3, 1, 0, []bool{true}},
+		{"comprimida", "a.sql.gz", &restoreTargetPrueba{}, RestoreOptions{}, false, 4, 3, 1, 0, []bool{true}},
+		{"se detiene en el error", "a.sql", &restoreTargetPrueba{falla: "(2)"}, RestoreOptions{}, true, 3, 1, 1, 1, []bool{false}},
+		{"continúa ante errores", "a.sql", &restoreTargetPrueba{falla: "(2)"}, RestoreOptions{ContinueOnError: true}, false, 4, 2, 1, 1, []bool{true}},
+		{"falla el cierre", "a.sql", &restoreTargetPrueba{errCierre: errors.New("commit failed")}, RestoreOptions{}, true, 4, 3, 1, 0, []bool{true}},
+	}
+	for _, caso := range casos {
+		ruta := writeDump(t, caso.archivo, dump)
+		resultado, err := Restore(context.Background(), ruta, caso.destino, caso.opciones)
+		if (err != nil) != caso.falla {
+			t.Errorf("%s: error %v", caso.nombre, err)
+		}
+		if resultado.Statements != caso.leidas || resultado.Executed != caso.ejecutadas ||
+			resultado.Skipped != caso.omitidas || resultado.Failed != caso.fallidas || len(resultado.Errors) != caso.fallidas {
+			t.Errorf("%s: resultado %+v", caso.nombre, resultado)
+		}
+		if !reflect.DeepEqual(caso.destino.cierres, caso.cierres) {
+			t.Errorf("%s: Close %v, esperado %v", caso.nombre, caso.destino.cierres, caso.cierres)
+		}
+	}
+}
+
+func TestRestoreSqlite(t *testing.T) {
+	ctx := context.Background()
+	dump := writeDump(t, "tienda.sql", "CREATE TABLE `t` (`id` int NOT NULL, `nombre` varchar(20), PRIMARY KEY (`id`));\n"+
+		"INSERT INTO `t` VALUES (1,'it\\'s'),(2,NULL);\n")
+
+	ruta := filepath.Join(t.TempDir(), "tienda.db")
+	destino, err := newSqliteRestore(ctx, ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, dump, destino, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var cantidad int
+	var nombre string
+	if err := db.QueryRow("SELECT count(*), max(nombre) FROM t").Scan(&cantidad, &nombre); err != nil || cantidad != 2 || nombre != "it's" {
+		t.Errorf("obtenido %d %q %v", cantidad, nombre, err)
+	}
+	if _, err := os.Stat(ruta + ".restore"); !os.IsNotExist(err) {
+		t.Errorf("quedó el archivo temporal: %v", err)
+	}
+
+	// una sentencia que falla descarta la base nueva
+	ruta = filepath.Join(t.TempDir(), "fallida.db")
+	if destino, err = newSqliteRestore(ctx, ruta); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, writeDump(t, "b.sql", "CREATE TABLE t (a INT);\nINSERT INTO x VALUES (1);\n"), destino, RestoreOptions{}); err == nil {
+		t.Error("se esperaba un error de la tabla inexistente")
+	}
+	if _, err := os.Stat(ruta); !os.IsNotExist(err) {
+		t.Errorf("la restauración fallida creó la base: %v", err)
+	}
+
+	// si mientras tanto se crea la base, el cierre falla y Restore lo informa
+	ruta = filepath.Join(t.TempDir(), "ocupada.db")
+	if destino, err = newSqliteRestore(ctx, ruta); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ruta, []byte("otra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, dump, destino, RestoreOptions{}); err == nil {
+		t.Error("se esperaba un error al mover la base restaurada")
+	}
+	if datos, _ := os.ReadFile(ruta); string(datos) != "otra" {
+		t.Error("la restauración reemplazó una base existente")
+	}
+	if _, err := newSqliteRestore(ctx, ruta); err == nil {
+		t.Error("newSqliteRestore debería rechazar una base existente")
+	}
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota // palabra clave o identificador sin comillas
+	tokIdent                   // identificador entre comillas invertidas
+	tokString                  // cadena, text sin comillas ni escapes
+	tokNumber
+	tokHex  // literal hexadecimal 0x.. o X'..', text son los dígitos
+	tokBits // literal de bits b'..' o 0b.., text son los dígitos
+	tokSymbol
+)
+
+// sqlToken es un elemento de una sentencia MySQL, ver tokenizeMysql
+type sqlToken struct {
+	kind tokenKind
+	text string
+}
+
+func (t sqlToken) is(palabra string) bool {
+	return (t.kind == tokWord || t.kind == tokSymbol) && strings.EqualFold(t.text, palabra)
+}
+
+// operadores de dos o más caracteres
+var mysqlOperators = []string{"->>", "<=>", "->", "<=", ">=", "<>", "!=", "||", "&&", ":=", "<<", ">>"}
+
+// escapes de las cadenas de MySQL, \% y \_ conservan la barra
+var mysqlEscapes = map[byte]string{'0': "\x00", '\'': "'", '"': "\"", 'b': "\b", 'n': "\n", 'r': "\r", 't': "\t", 'Z': "\x1a", '\\': "\\", '%': "\\%", '_': "\\_"}
+
+// tokenizeMysql separa una sentencia MySQL en tokens, descartando espacios y
+// comentarios (también /*! ... */, que solo tienen sentido en MySQL)
+func tokenizeMysql(sentencia string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	s := sentencia
+	n := len(s)
+	for i := 0; i < n; {
+		b := s[i]
+		switch {
+		case b == ' ' || b == '\t' || b == '\r' || b == '\n':
+			i++
+		case strings.HasPrefix(s[i:], "/*"):
+			fin := strings.Index(s[i+2:], "*/")
+			if fin < 0 {
+				return nil, fmt.Errorf("comentario sin cerrar")
+			}
+			i += fin + 4
+		case b == '#' || isDashComment(s[i:]):
+			for i < n && s[i] != '\n' {
+				i++
+			}
+		case b == '\'' || b == '"' || b == '`':
+			var sb strings.Builder
+			j := i + 1
+			cerrada := false
+			for j < n {
+				c := s[j]
+				if c == '\\' && b != '`' && j+1 < n {
+					if esc, ok := mysqlEscapes[s[j+1]]; ok {
+						sb.WriteString(esc)
+					} else {
+						sb.WriteByte(s[j+1])
+					}
+					j += 2
+					continue
+				}
+				if c == b {
+					if j+1 < n && s[j+1] == b {
+						sb.WriteByte(b)
+						j += 2
+						continue
+					}
+					cerrada = true
+					j++
+					break
+				}
+				sb.WriteByte(c)
+				j++
+			}
+			if !cerrada {
+				return nil, fmt.Errorf("cadena sin cerrar")
+			}
+			kind := tokString
+			if b == '`' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, sqlToken{kind, sb.String()})
+			i = j
+		case (b == 'x' || b == 'X' || b == 'b' || b == 'B') && i+1 < n && s[i+1] == '\'':
+			fin := strings.IndexByte(s[i+2:], '\'')
+			if fin < 0 {
+				return nil, fmt.Errorf("literal sin cerrar")
+			}
+			kind := tokHex
+			if b == 'b' || b == 'B' {
+				kind = tokBits
+			}
+			tokens = append(tokens, sqlToken{kind, s[i+2 : i+2+fin]})
+			i += fin + 3
+		case b == '0' && i+2 < n && (s[i+1] == 'x' || s[i+1] == 'b') && isHexDigit(s[i+2]):
+			j := i + 2
+			for j < n && isHexDigit(s[j]) {
+				j++
+			}
+			kind := tokHex
+			if s[i+1] == 'b' {
+				kind = tokBits
+			}
+			tokens = append(tokens, sqlToken{kind, s[i+2 : j]})
+			i = j
+		case b >= '0' && b <= '9' || (b == '.' && i+1 < n && s[i+1] >= '0' && s[i+1] <= '9'):
+			j := i
+			for j < n && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if j < n && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < n && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < n && s[k] >= '0' && s[k] <= '9' {
+					for j = k; j < n && s[j] >= '0' && s[j] <= '9'; j++ {
+					}
+				}
+			}
+			tokens = append(tokens, sqlToken{tokNumber, s[i:j]})
+			i = j
+		case isWordByte(b):
+			j := i
+			for j < n && (isWordByte(s[j]) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokWord, s[i:j]})
+			i = j
+		default:
+			largo := 1
+			for _, op := range mysqlOperators {
+				if strings.HasPrefix(s[i:], op) {
+					largo = len(op)
+					break
+				}
+			}
+			tokens = append(tokens, sqlToken{tokSymbol, s[i : i+largo]})
+			i += largo
+		}
+	}
+	return tokens, nil
+}
+
+func isHexDigit(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '$' || b >= 0x80 || unicode.IsLetter(rune(b))
+}
+
+// sqliteToken escribe un token con la sintaxis de SQLite
+func sqliteToken(t sqlToken) string {
+	switch t.kind {
+	case tokIdent:
+		return `"` + strings.ReplaceAll(t.text, `"`, `""`) + `"`
+	case tokString:
+		// SQLite corta los literales en el primer NUL, se escriben en hexadecimal
+		if strings.IndexByte(t.text, 0) >= 0 {
+			return "CAST(X'" + hex.EncodeToString([]byte(t.text)) + "' AS TEXT)"
+		}
+		return "'" + strings.ReplaceAll(t.text, "'", "''") + "'"
+	case tokHex:
+		digitos := t.text
+		if len(digitos)%2 == 1 {
+			digitos = "0" + digitos
+		}
+		return "X'" + strings.ToUpper(digitos) + "'"
+	case tokBits:
+		if n, err := strconv.ParseUint(t.text, 2, 64); err == nil {
+			return strconv.FormatUint(n, 10)
+		}
+	case tokSymbol:
+		switch t.text {
+		case "||":
+			return "OR"
+		case "&&":
+			return "AND"
+		}
+	}
+	return t.text
+}
+
+// sqliteText escribe los tokens con la sintaxis de SQLite
+func sqliteText(tokens []sqlToken) string {
+	var sb strings.Builder
+	for i, t := range tokens {
+		if i > 0 && !(t.kind == tokSymbol && (t.text == "," || t.text == ")" || t.text == ".")) &&
+			!(tokens[i-1].kind == tokSymbol && (tokens[i-1].text == "(" || tokens[i-1].text == ".")) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(sqliteToken(t))
+	}
+	return sb.String()
+}
+
+// group devuelve los tokens entre el paréntesis de tokens[desde] y su cierre,
+// y la posición siguiente al cierre
+func group(tokens []sqlToken, desde int) ([]sqlToken, int) {
+	profundidad := 0
+	for i := desde; i < len(tokens); i++ {
+		switch {
+		case tokens[i].is("("):
+			profundidad++
+		case tokens[i].is(")"):
+			profundidad--
+			if profundidad == 0 {
+				return tokens[desde+1 : i], i + 1
+			}
+		}
+	}
+	return tokens[desde+1:], len(tokens)
+}
+
+// splitCommas separa los tokens por las comas fuera de paréntesis
+func splitCommas(tokens []sqlToken) [][]sqlToken {
+	var partes [][]sqlToken
+	profundidad, inicio := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			profundidad++
+		case t.is(")"):
+			profundidad--
+		case t.is(",") && profundidad == 0:
+			partes = append(partes, tokens[inicio:i])
+			inicio = i + 1
+		}
+	}
+	return append(partes, tokens[inicio:])
+}
+
+func upperWord(tokens []sqlToken, i int) string {
+	if i < len(tokens) && tokens[i].kind == tokWord {
+		return strings.ToUpper(tokens[i].text)
+	}
+	return ""
+}
+
+// sentencias de MySQL que no tienen equivalente en SQLite
+var sqliteSkippedStatements = map[string]struct{}{
+	"SET": {}, "USE": {}, "LOCK": {}, "UNLOCK": {}, "START": {}, "BEGIN": {}, "COMMIT": {},
+	"ROLLBACK": {}, "FLUSH": {}, "GRANT": {}, "OPTIMIZE": {}, "ANALYZE": {},
+}
+
+// objetos de MySQL que no se crean en SQLite: las rutinas y los triggers usan
+// una sintaxis que SQLite no admite
+var sqliteSkippedObjects = map[string]struct{}{
+	"DATABASE": {}, "SCHEMA": {}, "PROCEDURE": {}, "FUNCTION": {}, "TRIGGER": {}, "EVENT": {}, "USER": {},
+}
+
+// sqliteColumn es una columna de una tabla creada durante la restauración
+type sqliteColumn struct {
+	name string
+	bit  bool // BIT en MySQL, los valores hexadecimales se insertan como enteros
+}
+
+// sqliteTranslator convierte las sentencias de un respaldo MySQL a SQLite:
+// comillas, escapes, literales binarios, tipos de columna, índices y opciones
+// de tabla. Las sentencias sin equivalente se omiten
+type sqliteTranslator struct {
+	tablas map[string][]sqliteColumn
+}
+
+func newSqliteTranslator() *sqliteTranslator {
+	return &sqliteTranslator{tablas: make(map[string][]sqliteColumn)}
+}
+
+// Translate devuelve las sentencias SQLite equivalentes, ninguna si se omite
+func (t *sqliteTranslator) Translate(sentencia string) ([]string, error) {
+	tokens, err := tokenizeMysql(sentencia)
+	if err != nil {
+		return nil, err
+	}
+	// los introductores de juego de caracteres (_utf8mb4'x', _binary'x') no existen en SQLite
+	limpios := tokens[:0]
+	for i, tok := range tokens {
+		if tok.kind == tokWord && strings.HasPrefix(tok.text, "_") && i+1 < len(tokens) &&
+			(tokens[i+1].kind == tokString || tokens[i+1].kind == tokHex) {
+			continue
+		}
+		limpios = append(limpios, tok)
+	}
+	tokens = limpios
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	primera := upperWord(tokens, 0)
+	if In(sqliteSkippedStatements, primera) {
+		return nil, nil
+	}
+	switch primera {
+	case "ALTER":
+		// ALTER TABLE ... DISABLE KEYS / ENABLE KEYS de mysqldump
+		if upperWord(tokens, len(tokens)-1) == "KEYS" {
+			return nil, nil
+		}
+	case "DROP":
+		if In(sqliteSkippedObjects, upperWord(tokens, 1)) {
+			return nil, nil
+		}
+	case "INSERT", "REPLACE":
+		return []string{t.translateInsert(tokens)}, nil
+	case "CREATE":
+		return t.translateCreate(tokens)
+	}
+	return []string{sqliteText(tokens)}, nil
+}
+
+// palabras que terminan el DEFINER de un CREATE
+var createObjectWords = map[string]struct{}{"SQL": {}, "VIEW": {}, "TRIGGER": {}, "PROCEDURE": {}, "FUNCTION": {}, "EVENT": {}}
+
+// translateCreate omite las cláusulas de MySQL entre CREATE y el tipo de objeto
+// (OR REPLACE, ALGORITHM, DEFINER, SQL SECURITY)
+func (t *sqliteTranslator) translateCreate(tokens []sqlToken) ([]string, error) {
+	i := 1
+	for prefijo := true; prefijo && i < len(tokens); {
+		switch upperWord(tokens, i) {
+		case "OR", "REPLACE", "TEMPORARY":
+			i++
+		case "ALGORITHM":
+			i += 3
+		case "DEFINER":
+			// DEFINER = usuario@host, hasta la palabra que sigue
+			for i++; i < len(tokens) && !In(createObjectWords, upperWord(tokens, i)); i++ {
+			}
+		case "SQL":
+			i += 3
+		default:
+			prefijo = false
+		}
+	}
+	objeto := upperWord(tokens, i)
+	switch {
+	case In(sqliteSkippedObjects, objeto):
+		return nil, nil
+	case objeto == "TABLE":
+		return t.translateCreateTable(tokens[i+1:])
+	case objeto == "VIEW":
+		resto := tokens[i+1:]
+		// WITH [CASCADED | LOCAL] CHECK OPTION no existe en SQLite
+		if n := len(resto); n >= 3 && upperWord(resto, n-1) == "OPTION" && upperWord(resto, n-2) == "CHECK" {
+			resto = resto[:n-2]
+			if upperWord(resto, len(resto)-1) == "CASCADED" || upperWord(resto, len(resto)-1) == "LOCAL" {
+				resto = resto[:len(resto)-1]
+			}
+			resto = resto[:len(resto)-1]
+		}
+		return []string{"CREATE VIEW " + sqliteText(resto)}, nil
+	}
+	return []string{sqliteText(tokens)}, nil
+}
+
+// sqliteType convierte un tipo de columna de MySQL, los tipos de texto
+// (TEXT, ENUM, SET, JSON, ...) pasan a TEXT
+func sqliteType(tipo string, args []sqlToken) string {
+	numeros := ""
+	if len(args) > 0 {
+		var partes []string
+		for _, arg := range args {
+			if arg.kind == tokNumber {
+				partes = append(partes, arg.text)
+			}
+		}
+		if len(partes) > 0 {
+			numeros = "(" + strings.Join(partes, ",") + ")"
+		}
+	}
+	switch tipo {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR", "BOOL", "BOOLEAN", "BIT", "SERIAL":
+		// exactamente INTEGER para que una PRIMARY KEY sea alias de rowid
+		return "INTEGER"
+	case "FLOAT", "DOUBLE", "REAL":
+		return "REAL"
+	case "DECIMAL", "NUMERIC", "DEC", "FIXED":
+		return "DECIMAL" + numeros
+	case "CHAR", "VARCHAR", "NCHAR", "NVARCHAR":
+		return tipo + numeros
+	case "DATE", "DATETIME", "TIMESTAMP", "TIME":
+		return tipo
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY", "POINT",
+		"LINESTRING", "POLYGON", "MULTIPOINT", "MULTILINESTRING", "MULTIPOLYGON", "GEOMETRYCOLLECTION":
+		return "BLOB"
+	}
+	return "TEXT"
+}
+
+// modificadores del tipo que se descartan
+var mysqlTypeModifiers = map[string]struct{}{"UNSIGNED": {}, "SIGNED": {}, "ZEROFILL": {}, "PRECISION": {}, "VARYING": {}}
+
+// funciones de fecha actual que se aceptan como DEFAULT
+var currentTimeDefaults = map[string]struct{}{"CURRENT_TIMESTAMP": {}, "NOW": {}, "LOCALTIME": {}, "LOCALTIMESTAMP": {}}
+
+// translateColumn convierte la definición de una columna
+func translateColumn(tokens []sqlToken) (string, sqliteColumn) {
+	columna := sqliteColumn{name: tokens[0].text}
+	partes := []string{sqliteToken(sqlToken{tokIdent, tokens[0].text})}
+	tipo := upperWord(tokens, 1)
+	columna.bit = tipo == "BIT"
+	i := 2
+	var args []sqlToken
+	if i < len(tokens) && tokens[i].is("(") {
+		args, i = group(tokens, i)
+	}
+	for i < len(tokens) && In(mysqlTypeModifiers, upperWord(tokens, i)) {
+		i++
+	}
+	partes = append(partes, sqliteType(tipo, args))
+
+	for i < len(tokens) {
+		palabra := upperWord(tokens, i)
+		switch palabra {
+		case "NOT":
+			partes = append(partes, "NOT NULL")
+			i += 2
+		case "DEFAULT":
+			i++
+			switch {
+			case i >= len(tokens):
+			case tokens[i].is("("):
+				var expresion []sqlToken
+				expresion, i = group(tokens, i)
+				partes = append(partes, "DEFAULT ("+sqliteText(expresion)+")")
+			case In(currentTimeDefaults, upperWord(tokens, i)):
+				i++
+				if i < len(tokens) && tokens[i].is("(") {
+					_, i = group(tokens, i)
+				}
+				partes = append(partes, "DEFAULT CURRENT_TIMESTAMP")
+			case (tokens[i].is("-") || tokens[i].is("+")) && i+1 < len(tokens):
+				partes = append(partes, "DEFAULT "+tokens[i].text+tokens[i+1].text)
+				i += 2
+			default:
+				partes = append(partes, "DEFAULT "+sqliteToken(tokens[i]))
+				i++
+			}
+		case "PRIMARY", "KEY":
+			partes = append(partes, "PRIMARY KEY")
+			i++
+			if upperWord(tokens, i) == "KEY" {
+				i++
+			}
+		case "UNIQUE":
+			partes = append(partes, "UNIQUE")
+			i++
+			if upperWord(tokens, i) == "KEY" {
+				i++
+			}
+		case "COMMENT", "CHARSET", "COLLATE", "SRID", "COLUMN_FORMAT", "STORAGE":
+			i += 2
+		case "CHARACTER":
+			i += 3
+		case "ON":
+			// ON UPDATE CURRENT_TIMESTAMP
+			i += 3
+			if i < len(tokens) && tokens[i].is("(") {
+				_, i = group(tokens, i)
+			}
+		case "GENERATED", "ALWAYS":
+			i++
+		case "AS":
+			var expresion []sqlToken
+			expresion, i = group(tokens, i+1)
+			partes = append(partes, "GENERATED ALWAYS AS ("+sqliteText(expresion)+")")
+		case "CHECK":
+			var expresion []sqlToken
+			expresion, i = group(tokens, i+1)
+			partes = append(partes, "CHECK ("+sqliteText(expresion)+")")
+		case "AUTO_INCREMENT", "VISIBLE", "INVISIBLE":
+			i++
+		case "REFERENCES":
+			partes = append(partes, sqliteText(tokens[i:]))
+			i = len(tokens)
+		default:
+			partes = append(partes, sqliteToken(tokens[i]))
+			i++
+		}
+	}
+	return strings.Join(partes, " "), columna
+}
+
+// indexColumns devuelve las columnas de un índice sin largo de prefijo ni
+// orden, nil si el índice usa expresiones
+func indexColumns(tokens []sqlToken) []string {
+	var columnas []string
+	for _, parte := range splitCommas(tokens) {
+		if len(parte) == 0 || (parte[0].kind != tokIdent && parte[0].kind != tokWord) {
+			return nil
+		}
+		columnas = append(columnas, sqliteToken(sqlToken{tokIdent, parte[0].text}))
+	}
+	return columnas
+}
+
+// translateCreateTable convierte CREATE TABLE: las claves e índices UNIQUE
+// quedan como restricciones, KEY e INDEX pasan a CREATE INDEX (con el nombre
+// de la tabla como prefijo, en SQLite los nombres de índice son globales) y las
+// opciones de tabla (ENGINE, CHARSET, ...) se descartan. FULLTEXT y SPATIAL se omiten
+func (t *sqliteTranslator) translateCreateTable(tokens []sqlToken) ([]string, error) {
+	i := 0
+	cabecera := "CREATE TABLE "
+	if upperWord(tokens, 0) == "IF" {
+		cabecera += "IF NOT EXISTS "
+		i = 3
+	}
+	if i+1 >= len(tokens) || !tokens[i+1].is("(") {
+		return []string{"CREATE TABLE " + sqliteText(tokens)}, nil
+	}
+	tabla := tokens[i].text
+	nombre := sqliteToken(sqlToken{tokIdent, tabla})
+	cuerpo, _ := group(tokens, i+1)
+
+	var definiciones, indices []string
+	var columnas []sqliteColumn
+	for _, item := range splitCommas(cuerpo) {
+		if len(item) == 0 {
+			continue
+		}
+		restriccion := ""
+		if upperWord(item, 0) == "CONSTRAINT" && len(item) > 2 {
+			restriccion = "CONSTRAINT " + sqliteToken(sqlToken{tokIdent, item[1].text}) + " "
+			item = item[2:]
+		}
+		// el grupo de columnas de una clave o índice, después del nombre opcional
+		columnasIndice := func() []string {
+			for j, tok := range item {
+				if tok.is("(") {
+					interno, _ := group(item, j)
+					return indexColumns(interno)
+				}
+			}
+			return nil
+		}
+		switch upperWord(item, 0) {
+		case "PRIMARY":
+			if cols := columnasIndice(); cols != nil {
+				definiciones = append(definiciones, restriccion+"PRIMARY KEY ("+strings.Join(cols, ", ")+")")
+			}
+		case "UNIQUE":
+			if cols := columnasIndice(); cols != nil {
+				definiciones = append(definiciones, restriccion+"UNIQUE ("+strings.Join(cols, ", ")+")")
+			}
+		case "KEY", "INDEX":
+			cols := columnasIndice()
+			if cols == nil {
+				continue
+			}
+			indice := tabla + "_" + strings.Join(cols, "_")
+			if item[1].kind == tokIdent || item[1].kind == tokWord {
+				indice = tabla + "_" + item[1].text
+			}
+			indices = append(indices, "CREATE INDEX "+sqliteToken(sqlToken{tokIdent, indice})+" ON "+nombre+" ("+strings.Join(cols, ", ")+")")
+		case "FULLTEXT", "SPATIAL":
+		case "FOREIGN", "CHECK":
+			definiciones = append(definiciones, restriccion+sqliteText(item))
+		default:
+			definicion, columna := translateColumn(item)
+			definiciones = append(definiciones, definicion)
+			columnas = append(columnas, columna)
+		}
+	}
+	t.tablas[tabla] = columnas
+
+	create := cabecera + nombre + " (\n  " + strings.Join(definiciones, ",\n  ") + "\n)"
+	return append([]string{create}, indices...), nil
+}
+
+// modificadores de INSERT que no existen en SQLite
+var insertModifiers = map[string]struct{}{"LOW_PRIORITY": {}, "DELAYED": {}, "HIGH_PRIORITY": {}}
+
+// translateInsert convierte INSERT IGNORE en INSERT OR IGNORE y los valores
+// hexadecimales de columnas BIT en enteros
+func (t *sqliteTranslator) translateInsert(tokens []sqlToken) string {
+	salida := append([]sqlToken{}, tokens...)
+	i := 1
+	for i < len(salida) && In(insertModifiers, upperWord(salida, i)) {
+		salida = append(salida[:i], salida[i+1:]...)
+	}
+	if upperWord(salida, i) == "IGNORE" {
+		salida[i] = sqlToken{tokWord, "OR IGNORE"}
+		i++
+	}
+	if upperWord(salida, i) == "INTO" {
+		i++
+	}
+	if i >= len(salida) {
+		return sqliteText(salida)
+	}
+	columnas := t.tablas[salida[i].text]
+	i++
+
+	// columnas en el orden de los valores
+	orden := columnas
+	if i < len(salida) && salida[i].is("(") {
+		var lista []sqlToken
+		lista, i = group(salida, i)
+		porNombre := make(map[string]sqliteColumn, len(columnas))
+		for _, col := range columnas {
+			porNombre[col.name] = col
+		}
+		orden = nil
+		for _, parte := range splitCommas(lista) {
+			if len(parte) > 0 {
+				orden = append(orden, porNombre[parte[0].text])
+			}
+		}
+	}
+	if upperWord(salida, i) == "VALUE" {
+		salida[i].text = "VALUES"
+	}
+
+	bits := false
+	for _, col := range orden {
+		bits = bits || col.bit
+	}
+	if !bits {
+		return sqliteText(salida)
+	}
+	profundidad, posicion := 0, 0
+	for ; i < len(salida); i++ {
+		tok := salida[i]
+		switch {
+		case tok.is("("):
+			profundidad++
+			if profundidad == 1 {
+				posicion = 0
+			}
+		case tok.is(")"):
+			profundidad--
+		case tok.is(",") && profundidad == 1:
+			posicion++
+		case tok.kind == tokHex && profundidad == 1 && posicion < len(orden) && orden[posicion].bit:
+			if n, err := strconv.ParseUint(tok.text, 16, 64); err == nil {
+				salida[i] = sqlToken{tokNumber, strconv.FormatUint(n, 10)}
+			}
+		}
+	}
+	return sqliteText(salida)
+}
+
+// sqliteRestore restaura en una base SQLite nueva. Se escribe en un archivo
+// temporal dentro de una transacción y solo al completar se mueve al nombre
+// final, así la base no se ve a medio restaurar
+type sqliteRestore struct {
+	db        *sql.DB
+	conn      *sql.Conn
+	ruta      string
+	temporal  string
+	traductor *sqliteTranslator
+}
+
+func newSqliteRestore(ctx context.Context, ruta string) (*sqliteRestore, error) {
+	if _, err := os.Stat(ruta); err == nil {
+		return nil, NewAPIError(http.StatusConflict, CodeInvalidRequest, "la base ya existe, la restauración en SQLite crea una base nueva")
+	}
+	temporal := ruta + ".restore"
+	os.Remove(temporal)
+	db, err := sql.Open(sqliteDriver, temporal)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "BEGIN")
+	}
+	if err != nil {
+		db.Close()
+		os.Remove(temporal)
+		return nil, err
+	}
+	return &sqliteRestore{db: db, conn: conn, ruta: ruta, temporal: temporal, traductor: newSqliteTranslator()}, nil
+}
+
+func (s *sqliteRestore) Exec(ctx context.Context, sentencia string) (bool, error) {
+	traducidas, err := s.traductor.Translate(sentencia)
+	if err != nil || len(traducidas) == 0 {
+		return err == nil, err
+	}
+	for _, traducida := range traducidas {
+		if _, err := s.conn.ExecContext(ctx, traducida); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (s *sqliteRestore) Close(ok bool) error {
+	fin := "ROLLBACK"
+	if ok {
+		fin = "COMMIT"
+	}
+	_, err := s.conn.ExecContext(context.Background(), fin)
+	s.conn.Close()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	if ok && err == nil {
+		// Link falla si mientras tanto se creó una base con el mismo nombre
+		if err = os.Link(s.temporal, s.ruta); err != nil {
+			err = fmt.Errorf("error moviendo la base restaurada: %v", err)
+		}
+	}
+	os.Remove(s.temporal)
+	return err
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tipos de columna cuyos valores en texto se devuelven como número JSON exacto
+var numericColumns = map[string]struct{}{
+	"TINYINT": {}, "SMALLINT": {}, "MEDIUMINT": {}, "INT": {}, "INTEGER": {}, "BIGINT": {},
+	"YEAR": {}, "DECIMAL": {}, "NUMERIC": {}, "FLOAT": {}, "DOUBLE": {}, "REAL": {},
+}
+
+// columnKinds agrupa los nombres de tipo de MySQL y SQLite en la clase que
+// decide cómo se representa el valor en modo metadata
+var columnKinds = map[string]string{
+	"TINYINT": "integer", "SMALLINT": "integer", "MEDIUMINT": "integer", "INT": "integer",
+	"INTEGER": "integer", "BIGINT": "integer", "YEAR": "integer", "BIT": "bit",
+	"DECIMAL": "decimal", "NUMERIC": "decimal",
+	"FLOAT": "float", "DOUBLE": "float", "REAL": "float",
+	"BOOL": "bool", "BOOLEAN": "bool",
+	"DATE": "date", "DATETIME": "datetime", "TIMESTAMP": "datetime", "TIME": "time",
+	"BLOB": "blob", "TINYBLOB": "blob", "MEDIUMBLOB": "blob", "LONGBLOB": "blob",
+	"BINARY": "blob", "VARBINARY": "blob", "GEOMETRY": "blob",
+	"JSON": "json",
+}
+
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// ColumnInfo describe una columna del resultado en modo metadata
+type ColumnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`     // tipo informado por la base de datos
+	Kind     string `json:"kind"`     // integer, decimal, float, bool, date, datetime, time, blob, json, text o any
+	Nullable *bool  `json:"nullable"` // null si el driver no lo informa
+}
+
+// ResultSet son las filas de un select y, en modo metadata, sus columnas
+type ResultSet struct {
+	Names   []string // nombres de las columnas en orden
+	Columns []ColumnInfo
+	Rows    []map[string]any
+	Next    string // cursor de la página siguiente, vacío si no hay más
+	// "maxrows" o "maxbytes" si el resultado se cortó por un límite (ver Limits)
+	Truncated string
+}
+
+// SelectOptions son las opciones de un select: metadata de columnas, paginación
+// y límites del resultado
+type SelectOptions struct {
+	Metadata bool
+	Page     *PageRequest
+	Limits   Limits
+}
+
+// SelectSqlite ejecuta un select en el pool de solo lectura de dbName
+func SelectSqlite(ctx context.Context, dbName, consulta string, opciones SelectOptions, parametros ...any) (ResultSet, error) {
+	return selectRows(ctx, "sqlite3", dbName, consulta, opciones, parametros...)
+}
+
+// SelectMysql ejecuta un select dentro de una transacción de solo lectura
+func SelectMysql(ctx context.Context, dsn, consulta string, opciones SelectOptions, parametros ...any) (ResultSet, error) {
+	return selectRows(ctx, "mysql", dsn, consulta, opciones, parametros...)
+}
+
+// selectRows lee todas las filas del resultado, ver rowScanner. Con página
+// se leen Size filas y la siguiente, si existe, solo indica que hay más. Al
+// alcanzar un límite de opciones.Limits se deja de leer y se marca Truncated
+func selectRows(ctx context.Context, dbtype, destino, consulta string, opciones SelectOptions, parametros ...any) (ResultSet, error) {
+	query, params := consulta, parametros
+	if opciones.Page != nil {
+		var err error
+		if query, params, err = opciones.Page.Apply(dbtype, consulta, parametros); err != nil {
+			return ResultSet{}, err
+		}
+	}
+
+	filas, cerrar, err := openSelect(ctx, dbtype, destino, query, params...)
+	if err != nil {
+		return ResultSet{}, err
+	}
+	defer cerrar()
+
+	scanner, err := newRowScanner(filas, dbtype, opciones.Metadata)
+	if err != nil {
+		return ResultSet{}, err
+	}
+
+	if opciones.Page != nil {
+		if err := opciones.Page.CheckColumns(scanner.Names()); err != nil {
+			return ResultSet{}, err
+		}
+	}
+
+	resultado := ResultSet{Names: scanner.Names(), Columns: scanner.Columns}
+	limitador := rowLimiter{limites: opciones.Limits}
+	var ultimaClave []any // valores de Key de la última fila agregada, para el cursor
+	for scanner.Next() {
+		if opciones.Page != nil && len(resultado.Rows) == opciones.Page.Size {
+			resultado.Next = opciones.Page.NextCursor(consulta, parametros, ultimaClave)
+			break
+		}
+		fila, err := scanner.Row()
+		if err != nil {
+			return ResultSet{}, err
+		}
+		if !limitador.Allow(limitador.Size(fila)) {
+			// con página el cliente puede seguir desde la última fila enviada
+			resultado.Truncated = limitador.Truncated
+			if opciones.Page != nil && len(resultado.Rows) > 0 {
+				resultado.Next = opciones.Page.NextCursor(consulta, parametros, ultimaClave)
+			}
+			break
+		}
+		resultado.Rows = append(resultado.Rows, fila)
+		if opciones.Page != nil {
+			ultimaClave = scanner.KeyValues(opciones.Page.Key)
+		}
+	}
+	return resultado, scanner.Err()
+}
+
+// openSelect ejecuta el select en solo lectura: en sqlite3 destino es el archivo
+// y se usa su pool de solo lectura, en mysql es el dsn y se abre una transacción
+// READ ONLY. cerrar libera las filas y la transacción
+func openSelect(ctx context.Context, dbtype, destino, consulta string, parametros ...any) (*sql.Rows, func(), error) {
+	if dbtype == "sqlite3" {
+		db, err := GetPool("sqlite3", ReadOnlyDSN(destino))
+		if err != nil {
+			return nil, nil, err
+		}
+		filas, err := db.QueryContext(ctx, consulta, parametros...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return filas, func() { filas.Close() }, nil
+	}
+
+	db, err := GetPool("mysql", destino)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	filas, err := tx.QueryContext(ctx, consulta, parametros...)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return filas, func() {
+		filas.Close()
+		tx.Rollback()
+	}, nil
+}
+
+// RespondRows envía el resultado de un select en el formato pedido, con
+// "columns" en modo metadata, "next" cuando se pidió una página y "truncated"
+// si se alcanzó un límite. Fuera de json el cursor y el límite también se
+// envían en las cabeceras X-Next-Cursor y X-Truncated
+func RespondRows(c *gin.Context, formato string, resultado ResultSet, opciones SelectOptions) {
+	var next any
+	if resultado.Next != "" {
+		next = resultado.Next
+	}
+	if formato == FormatJSON {
+		respuesta := gin.H{"status": "success", "data": resultado.Rows}
+		if opciones.Metadata {
+			respuesta["columns"] = resultado.Columns
+		}
+		if opciones.Page != nil {
+			respuesta["next"] = next
+		}
+		resultado.addTruncated(respuesta)
+		c.JSON(http.StatusOK, respuesta)
+		return
+	}
+
+	estado := gin.H{"status": "success", "rows": len(resultado.Rows)}
+	// csv corta la respuesta truncada (ver csvRowWriter), aquí alcanza con la cabecera
+	if formato != FormatCSV {
+		resultado.addTruncated(estado)
+	}
+	if opciones.Page != nil {
+		estado["next"] = next
+		c.Header("X-Next-Cursor", resultado.Next)
+	}
+	if resultado.Truncated != "" {
+		c.Header("X-Truncated", resultado.Truncated)
+	}
+	c.Header("Content-Type", formatContentTypes[formato])
+	c.Status(http.StatusOK)
+	escritor := newRowWriter(formato, c.Writer)
+	var info []ColumnInfo
+	if opciones.Metadata {
+		info = resultado.Columns
+	}
+	if err := escritor.Begin(resultado.Names, info); err != nil {
+		c.Error(err)
+		return
+	}
+	for _, fila := range resultado.Rows {
+		if err := escritor.Row(fila); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := escritor.End(estado); err != nil {
+		c.Error(err)
+	}
+}
+
+// addTruncated agrega "truncated" y "truncatedBy" a la respuesta si el
+// resultado se cortó por un límite
+func (r ResultSet) addTruncated(respuesta gin.H) {
+	if r.Truncated != "" {
+		respuesta["truncated"] = true
+		respuesta["truncatedBy"] = r.Truncated
+	}
+}
+
+// rowScanner convierte cada fila en un mapa columna -> valor. Sin metadata los
+// valores []byte se devuelven como texto salvo en columnas numéricas (BIGINT,
+// DECIMAL, ...), donde se devuelven como json.Number para no perder precisión.
+// Con metadata describe las columnas y representa cada valor según la clase de
+// su columna de la misma forma en MySQL y SQLite
+type rowScanner struct {
+	Columns []ColumnInfo // solo con metadata
+
+	filas     *sql.Rows
+	metadata  bool
+	columnas  []string
+	numericas []bool
+	clases    []string
+	valores   []any
+	punteros  []any
+}
+
+func newRowScanner(filas *sql.Rows, dbtype string, metadata bool) (*rowScanner, error) {
+	columnas, err := filas.Columns()
+	if err != nil {
+		return nil, err
+	}
+	tipos, err := filas.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &rowScanner{
+		filas:     filas,
+		metadata:  metadata,
+		columnas:  columnas,
+		numericas: make([]bool, len(columnas)),
+		clases:    make([]string, len(columnas)),
+		valores:   make([]any, len(columnas)),
+		punteros:  make([]any, len(columnas)),
+	}
+	for i, tipo := range tipos {
+		s.numericas[i] = isNumericColumn(tipo.DatabaseTypeName())
+		s.clases[i] = columnKind(tipo.DatabaseTypeName())
+		if metadata {
+			info := ColumnInfo{Name: columnas[i], Type: tipo.DatabaseTypeName(), Kind: s.clases[i]}
+			// go-sqlite3 siempre informa nullable true, solo MySQL lo sabe por columna
+			if nullable, ok := tipo.Nullable(); ok && dbtype == "mysql" {
+				info.Nullable = &nullable
+			}
+			s.Columns = append(s.Columns, info)
+		}
+	}
+	for i := range s.punteros {
+		s.punteros[i] = &s.valores[i]
+	}
+	return s, nil
+}
+
+func (s *rowScanner) Next() bool {
+	return s.filas.Next()
+}
+
+// Names devuelve los nombres de las columnas en el orden del select
+func (s *rowScanner) Names() []string {
+	return s.columnas
+}
+
+func (s *rowScanner) Err() error {
+	return s.filas.Err()
+}
+
+// Row lee la fila actual, cada llamada devuelve un mapa nuevo
+func (s *rowScanner) Row() (map[string]any, error) {
+	if err := s.filas.Scan(s.punteros...); err != nil {
+		return nil, err
+	}
+
+	fila := make(map[string]any, len(s.columnas))
+	for i, col := range s.columnas {
+		if s.metadata {
+			fila[col] = renderValue(s.clases[i], s.valores[i])
+			continue
+		}
+		switch v := s.valores[i].(type) {
+		case []byte:
+			if s.numericas[i] && jsonNumberPattern.Match(v) {
+				fila[col] = json.Number(v)
+			} else {
+				fila[col] = string(v)
+			}
+		default:
+			fila[col] = v
+		}
+	}
+	return fila, nil
+}
+
+// KeyValues devuelve los valores de columnas en la fila leída por Row tal como
+// los devolvió el driver, para compararlos en la página siguiente: los blobs
+// como bytes, el resto de los []byte como texto y las fechas con el formato de
+// su clase. Las columnas deben estar en el resultado (ver CheckColumns)
+func (s *rowScanner) KeyValues(columnas []string) []any {
+	valores := make([]any, len(columnas))
+	for i, col := range columnas {
+		j := slices.Index(s.columnas, col)
+		switch v := s.valores[j].(type) {
+		case []byte:
+			if s.clases[j] == "blob" || s.clases[j] == "any" {
+				valores[i] = v
+			} else {
+				valores[i] = string(v)
+			}
+		case time.Time:
+			valores[i] = formatTime(s.clases[j], v)
+		default:
+			valores[i] = v
+		}
+	}
+	return valores
+}
+
+// renderValue representa un valor según la clase de su columna: enteros y
+// flotantes como números, decimales como número JSON exacto, fechas como
+// texto (YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, HH:MM:SS) y blobs en base64
+func renderValue(clase string, valor any) any {
+	switch v := valor.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return renderText(clase, v)
+	case string:
+		if clase == "any" {
+			return v
+		}
+		return renderText(clase, []byte(v))
+	case time.Time:
+		return formatTime(clase, v)
+	case int64:
+		if clase == "bool" {
+			return v != 0
+		}
+	}
+	return valor
+}
+
+// formatTime escribe una fecha según la clase de su columna
+func formatTime(clase string, v time.Time) string {
+	switch clase {
+	case "date":
+		return v.Format(dateLayout)
+	case "time":
+		return v.Format("15:04:05.999999")
+	}
+	return v.Format(datetimeLayout)
+}
+
+// renderText convierte los valores que el driver devuelve como texto o bytes
+func renderText(clase string, v []byte) any {
+	texto := string(v)
+	switch clase {
+	case "integer":
+		if n, err := strconv.ParseInt(texto, 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(texto, 10, 64); err == nil {
+			return n
+		}
+	case "bit":
+		// MySQL devuelve BIT(n) como bytes big-endian
+		if len(v) <= 8 {
+			relleno := make([]byte, 8-len(v), 8)
+			return binary.BigEndian.Uint64(append(relleno, v...))
+		}
+	case "decimal":
+		if jsonNumberPattern.MatchString(texto) {
+			return json.Number(texto)
+		}
+	case "float":
+		if n, err := strconv.ParseFloat(texto, 64); err == nil {
+			return n
+		}
+	case "bool":
+		if n, err := strconv.ParseInt(texto, 10, 64); err == nil {
+			return n != 0
+		}
+	case "json":
+		if json.Valid(v) {
+			return json.RawMessage(v)
+		}
+	case "blob", "any":
+		// sin tipo declarado SQLite solo devuelve []byte para valores BLOB
+		return base64.StdEncoding.EncodeToString(v)
+	}
+	return texto
+}
+
+// normalizeColumnType quita UNSIGNED, la longitud y los modificadores:
+// "UNSIGNED BIGINT" -> "BIGINT", "DECIMAL(10,2)" -> "DECIMAL"
+func normalizeColumnType(tipo string) string {
+	tipo = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(tipo)), "UNSIGNED ")
+	if i := strings.IndexAny(tipo, "( "); i >= 0 {
+		tipo = tipo[:i]
+	}
+	return tipo
+}
+
+// isNumericColumn reconoce los nombres de tipo de MySQL ("UNSIGNED BIGINT") y
+// los tipos declarados en SQLite ("DECIMAL(10,2)")
+func isNumericColumn(tipo string) bool {
+	return In(numericColumns, normalizeColumnType(tipo))
+}
+
+// columnKind clasifica el tipo de columna, los tipos declarados de SQLite que no
+// están en columnKinds se resuelven con las reglas de afinidad de SQLite
+func columnKind(tipo string) string {
+	nombre := normalizeColumnType(tipo)
+	if clase, ok := columnKinds[nombre]; ok {
+		return clase
+	}
+	switch {
+	case nombre == "":
+		return "any"
+	case strings.Contains(nombre, "INT"):
+		return "integer"
+	case strings.Contains(nombre, "REAL"), strings.Contains(nombre, "FLOA"), strings.Contains(nombre, "DOUB"):
+		return "float"
+	}
+	return "text"
+}
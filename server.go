@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// tiempo para terminar las solicitudes en curso si dbsettings.json no define shutdowntimeout
+	defaultShutdownWait = 30 * time.Second
+	// tiempo que se espera a las solicitudes ya canceladas antes de cerrar las conexiones
+	shutdownCancelWait = 5 * time.Second
+	// tiempo que se espera a los handlers tras cerrar las conexiones, y después a
+	// que suelten las bases badger, antes de cerrarlas
+	shutdownHandlersWait = 5 * time.Second
+)
+
+// errShuttingDown es la causa de la cancelación de las solicitudes al apagar,
+// la distingue de la desconexión del cliente (ver contextError)
+var errShuttingDown = errors.New("el servidor se está apagando")
+
+// Server atiende las solicitudes y las tareas de fondo (respaldos) hasta recibir
+// SIGINT o SIGTERM, y entonces apaga todo en orden (ver Run)
+type Server struct {
+	http   *http.Server
+	espera time.Duration // tiempo para terminar las solicitudes en curso
+
+	// base es el contexto de todas las solicitudes, cancelarlo cancela sus consultas
+	base      context.Context
+	cancelar  context.CancelCauseFunc
+	tareas    sync.WaitGroup
+	ctxTareas context.Context
+	detener   context.CancelFunc
+
+	// handlers en curso, http.Server.Close no espera a que terminen
+	enCurso atomic.Int64
+}
+
+// NewServer crea el servidor en addr, espera es el tiempo máximo para terminar
+// las solicitudes en curso al apagar (defaultShutdownWait si es 0)
+func NewServer(addr string, handler http.Handler, espera time.Duration) *Server {
+	if espera <= 0 {
+		espera = defaultShutdownWait
+	}
+	s := &Server{espera: espera}
+	s.base, s.cancelar = context.WithCancelCause(context.Background())
+	s.ctxTareas, s.detener = context.WithCancel(context.Background())
+	s.http = &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.enCurso.Add(1)
+			defer s.enCurso.Add(-1)
+			handler.ServeHTTP(w, r)
+		}),
+		BaseContext: func(net.Listener) context.Context {
+			return s.base
+		},
+	}
+	return s
+}
+
+// Go ejecuta una tarea de fondo, su contexto se cancela al apagar el servidor
+// y el apagado espera a que termine
+func (s *Server) Go(tarea func(ctx context.Context)) {
+	s.tareas.Add(1)
+	go func() {
+		defer s.tareas.Done()
+		tarea(s.ctxTareas)
+	}()
+}
+
+// Run atiende hasta recibir SIGINT o SIGTERM y apaga en este orden: deja de
+// aceptar conexiones y espera las solicitudes en curso; si no terminan a
+// tiempo cancela su contexto, lo que cancela las consultas, y si aun así no
+// terminan cierra las conexiones y espera a los handlers; detiene las tareas
+// de fondo y por último cierra los pools SQL y las bases badger. Una segunda
+// señal termina el proceso de inmediato
+func (s *Server) Run() error {
+	senal, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errores := make(chan error, 1)
+	go func() {
+		errores <- s.http.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errores:
+		s.detener()
+		s.tareas.Wait()
+		s.closeStores()
+		return err
+	case <-senal.Done():
+	}
+	stop()
+	PrintGreen("APAGANDO SERVIDOR...")
+
+	var firstErr error
+	ctx, cancel := context.WithTimeout(context.Background(), s.espera)
+	err := s.http.Shutdown(ctx)
+	cancel()
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("las solicitudes en curso no terminaron a tiempo, se cancelan sus consultas")
+		s.cancelar(errShuttingDown)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownCancelWait)
+		err = s.http.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			s.http.Close()
+			// Close no espera a los handlers, pueden seguir usando las bases
+			if !s.waitHandlers(shutdownHandlersWait) {
+				log.Println("hay solicitudes que no terminaron, sus bases no se cierran")
+			}
+		}
+	}
+	if err != nil {
+		firstErr = err
+	}
+	s.cancelar(errShuttingDown)
+
+	s.detener()
+	s.tareas.Wait()
+
+	if err := s.closeStores(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// waitHandlers espera hasta espera a que terminen los handlers en curso,
+// devuelve false si alguno sigue
+func (s *Server) waitHandlers(espera time.Duration) bool {
+	limite := time.Now().Add(espera)
+	for s.enCurso.Load() > 0 {
+		if time.Now().After(limite) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// closeStores cierra los pools de conexiones y las bases badger, las bases que
+// todavía usa alguna solicitud se esperan hasta shutdownHandlersWait
+func (s *Server) closeStores() error {
+	var firstErr error
+	if err := ClosePools(); err != nil {
+		log.Println(err)
+		firstErr = err
+	}
+	if err := CloseBadgers(shutdownHandlersWait); err != nil {
+		log.Println(err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
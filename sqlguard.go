@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// StatementKind es la clase de una sentencia SQL según su primera palabra clave
+type StatementKind int
+
+const (
+	KindRead StatementKind = iota
+	KindDML
+	KindDDL
+	KindAdmin
+	KindForbidden
+)
+
+func (k StatementKind) String() string {
+	switch k {
+	case KindRead:
+		return "lectura"
+	case KindDML:
+		return "DML"
+	case KindDDL:
+		return "DDL"
+	case KindAdmin:
+		return "administración"
+	default:
+		return "no permitida"
+	}
+}
+
+var statementKinds = map[string]StatementKind{
+	"SELECT": KindRead, "SHOW": KindRead, "DESCRIBE": KindRead, "DESC": KindRead,
+	"EXPLAIN": KindRead, "VALUES": KindRead, "TABLE": KindRead,
+
+	"INSERT": KindDML, "UPDATE": KindDML, "DELETE": KindDML, "REPLACE": KindDML,
+	"MERGE": KindDML, "CALL": KindDML, "DO": KindDML,
+
+	"CREATE": KindDDL, "ALTER": KindDDL, "DROP": KindDDL, "TRUNCATE": KindDDL,
+	"RENAME": KindDDL, "COMMENT": KindDDL,
+
+	"PRAGMA": KindAdmin, "ANALYZE": KindAdmin, "REINDEX": KindAdmin,
+	"OPTIMIZE": KindAdmin, "CHECK": KindAdmin, "REPAIR": KindAdmin,
+}
+
+// palabras que prohíben la sentencia aparezcan donde aparezcan: escritura de
+// archivos en MySQL, carga de extensiones y bases adjuntas en SQLite
+var forbiddenWords = map[string]struct{}{
+	"OUTFILE": {}, "DUMPFILE": {}, "LOAD_EXTENSION": {}, "ATTACH": {}, "DETACH": {},
+}
+
+// forbiddenReasons explica por qué se rechazan algunas sentencias, según su
+// primera palabra. SQLite ejecuta VACUUM y VACUUM INTO con un ATTACH interno,
+// que falla porque las conexiones no admiten bases adjuntas
+var forbiddenReasons = map[string]string{
+	"VACUUM": "VACUUM no está disponible, SQLite lo ejecuta con un ATTACH interno y las bases adjuntas están deshabilitadas",
+}
+
+// querytypeKinds indica qué clases de sentencia acepta cada querytype
+var querytypeKinds = map[string][]StatementKind{
+	"select": {KindRead},
+	"exec":   {KindDML},
+	"alter":  {KindDDL, KindAdmin},
+	"batch":  {KindDML},
+}
+
+// ClassifyStatement clasifica una sentencia individual. Las sentencias WITH se
+// clasifican por la primera palabra clave principal después de las CTE y las
+// desconocidas (ATTACH, SET, USE, GRANT, BEGIN, ...) quedan prohibidas.
+// backslash tiene el mismo significado que en SplitStatements. Si el texto
+// tiene varias sentencias fuera de un cuerpo BEGIN ... END se clasifica cada
+// una y todas deben ser de la misma clase
+func ClassifyStatement(texto string, backslash bool) StatementKind {
+	if piezas := splitStatements(texto, backslash, false); len(piezas) > 1 && !isCompoundStatement(texto, backslash) {
+		kind := ClassifyStatement(piezas[0].Text, backslash)
+		for _, pieza := range piezas[1:] {
+			if ClassifyStatement(pieza.Text, backslash) != kind {
+				return KindForbidden
+			}
+		}
+		return kind
+	}
+
+	principales, todas := sqlWords(texto, backslash)
+	for _, palabra := range todas {
+		if In(forbiddenWords, palabra) {
+			return KindForbidden
+		}
+	}
+	if len(principales) == 0 {
+		return KindForbidden
+	}
+
+	primera := principales[0]
+	if primera == "WITH" {
+		for _, palabra := range principales[1:] {
+			switch palabra {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE":
+				return statementKinds[palabra]
+			}
+		}
+		return KindForbidden
+	}
+	if kind, ok := statementKinds[primera]; ok {
+		return kind
+	}
+	return KindForbidden
+}
+
+// isCompoundStatement indica si texto es un CREATE TRIGGER, PROCEDURE, FUNCTION o EVENT
+func isCompoundStatement(texto string, backslash bool) bool {
+	runes := []rune(texto)
+	palabra, fin := readWord(runes, skipSpaceAndComments(runes, 0, backslash))
+	return palabra == "CREATE" && isCompoundCreate(runes, fin, backslash)
+}
+
+// CheckStatements comprueba que las sentencias correspondan al querytype declarado
+// y rechaza los scripts con varias sentencias si allowMulti es false
+func CheckStatements(consulta Consulta, allowMulti bool) error {
+	if consulta.Querytype == "batch" {
+		for i, sentencia := range consulta.Statements {
+			if err := checkScript(consulta.DbType, "batch", sentencia.Dbquery, false); err != nil {
+				return fmt.Errorf("sentencia %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	return checkScript(consulta.DbType, consulta.Querytype, consulta.Dbquery, allowMulti)
+}
+
+func checkScript(dbtype, querytype, script string, allowMulti bool) error {
+	backslash := dbtype == "mysql"
+	sentencias := SplitStatements(script, backslash)
+	if len(sentencias) == 0 {
+		return NewAPIError(http.StatusBadRequest, CodeInvalidRequest, "dbquery no contiene ninguna sentencia")
+	}
+	if len(sentencias) > 1 && !allowMulti {
+		return NewAPIError(http.StatusBadRequest, CodeMultiStatement,
+			fmt.Sprintf("dbquery contiene %d sentencias y esta apikey no permite varias sentencias", len(sentencias)))
+	}
+
+	permitidas := querytypeKinds[querytype]
+	for _, sentencia := range sentencias {
+		kind := ClassifyStatement(sentencia.Text, backslash)
+		if kind == KindForbidden {
+			mensaje := fmt.Sprintf("sentencia no permitida: %s", abbreviate(sentencia.Text))
+			if principales, _ := sqlWords(sentencia.Text, backslash); len(principales) > 0 && forbiddenReasons[principales[0]] != "" {
+				mensaje = fmt.Sprintf("%s: %s", forbiddenReasons[principales[0]], abbreviate(sentencia.Text))
+			}
+			return NewAPIError(http.StatusForbidden, CodeQueryForbidden, mensaje)
+		}
+		valida := false
+		for _, permitida := range permitidas {
+			if kind == permitida {
+				valida = true
+			}
+		}
+		if !valida {
+			return NewAPIError(http.StatusBadRequest, CodeQuerytypeMismatch,
+				fmt.Sprintf("querytype '%s' no admite sentencias de %s: %s", querytype, kind, abbreviate(sentencia.Text)))
+		}
+	}
+	return nil
+}
+
+// sqlWords devuelve en mayúsculas las palabras fuera de cadenas y comentarios:
+// las que están fuera de paréntesis y todas
+func sqlWords(texto string, backslash bool) ([]string, []string) {
+	var principales, todas []string
+	profundidad := 0
+	runes := []rune(texto)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			j := i + 1
+			for j < n && runes[j] != r {
+				if backslash && r != '`' && runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j
+		case isLineComment(runes, i, backslash):
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+		case backslash && r == '/' && i+2 < n && runes[i+1] == '*' && runes[i+2] == '!':
+			// MySQL ejecuta el contenido de /*! ... */, se analiza como código
+			i += 3
+			for i < n && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			i--
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			i += 2
+			for i+1 < n && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+		case r == '(':
+			profundidad++
+		case r == ')':
+			if profundidad > 0 {
+				profundidad--
+			}
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < n && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '$') {
+				j++
+			}
+			palabra := strings.ToUpper(string(runes[i:j]))
+			todas = append(todas, palabra)
+			if profundidad == 0 {
+				principales = append(principales, palabra)
+			}
+			i = j - 1
+		}
+	}
+	return principales, todas
+}
+
+func abbreviate(texto string) string {
+	texto = strings.Join(strings.Fields(texto), " ")
+	if len([]rune(texto)) > 60 {
+		return string([]rune(texto)[:60]) + "..."
+	}
+	return texto
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	casos := []struct {
+		texto     string
+		backslash bool
+		esperado  StatementKind
+	}{
+		{"SELECT * FROM t", false, KindRead},
+		{"  -- comentario\n select 1", false, KindRead},
+		{"/* x */ INSERT INTO t VALUES (1)", false, KindDML},
+		{"WITH c AS (SELECT 1) SELECT * FROM c", false, KindRead},
+		{"WITH c AS (SELECT 1) DELETE FROM t WHERE a IN (SELECT * FROM c)", false, KindDML},
+		{"WITH c AS (SELECT 1)", false, KindForbidden},
+		{"CREATE TABLE t(function INT, begin INT)", false, KindDDL},
+		{"PRAGMA table_info(t)", false, KindAdmin},
+		{"ATTACH DATABASE '/tmp/x.db' AS a", false, KindForbidden},
+		{"VACUUM", false, KindForbidden},
+		{"VACUUM INTO '/tmp/copia.db'", false, KindForbidden},
+		{"DETACH DATABASE a", false, KindForbidden},
+		{"SELECT * FROM t INTO OUTFILE '/tmp/x'", true, KindForbidden},
+		{"SELECT load_extension('x')", false, KindForbidden},
+		{"SELECT 'ATTACH' AS a, \"detach\" FROM t", false, KindRead},
+		{"SELECT 1 -- attach", false, KindRead},
+		{"/*!50000 SELECT 1 INTO OUTFILE '/tmp/x' */", true, KindForbidden},
+		{"SET @a = 1", true, KindForbidden},
+		{"BEGIN", false, KindForbidden},
+		{"", false, KindForbidden},
+		// varias sentencias en un solo texto: se clasifica cada una
+		{"CREATE TABLE t(function INT, begin INT); ATTACH DATABASE '/tmp/x.db' AS a; CREATE TABLE a.pwn(x)", false, KindForbidden},
+		{"CREATE TABLE a(x); DROP TABLE b", false, KindDDL},
+		{"CREATE TABLE a(x); INSERT INTO a VALUES (1)", false, KindForbidden},
+		{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN INSERT INTO l VALUES (1); DELETE FROM c; END", false, KindDDL},
+	}
+	for _, caso := range casos {
+		if obtenido := ClassifyStatement(caso.texto, caso.backslash); obtenido != caso.esperado {
+			t.Errorf("%q: obtenido %s, esperado %s", caso.texto, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestSqlWords(t *testing.T) {
+	casos := []struct {
+		texto       string
+		backslash   bool
+		principales []string
+		todas       []string
+	}{
+		{"select a from t", false, []string{"SELECT", "A", "FROM", "T"}, []string{"SELECT", "A", "FROM", "T"}},
+		{"SELECT count(x) FROM t", false, []string{"SELECT", "COUNT", "FROM", "T"}, []string{"SELECT", "COUNT", "X", "FROM", "T"}},
+		{"SELECT 'attach' , \"detach\" , `load`", true, []string{"SELECT"}, []string{"SELECT"}},
+		{"SELECT 1 -- into outfile\n", false, []string{"SELECT"}, []string{"SELECT"}},
+		{"SELECT 1 # into outfile", true, []string{"SELECT"}, []string{"SELECT"}},
+		{"SELECT 1 # no es comentario en sqlite", false, []string{"SELECT", "NO", "ES", "COMENTARIO", "EN", "SQLITE"}, []string{"SELECT", "NO", "ES", "COMENTARIO", "EN", "SQLITE"}},
+		{"SELECT /* attach */ 1", false, []string{"SELECT"}, []string{"SELECT"}},
+		{"/*!50000 SELECT 1 INTO OUTFILE 'x' */", true, []string{"SELECT", "INTO", "OUTFILE"}, []string{"SELECT", "INTO", "OUTFILE"}},
+		{`SELECT 'a\' attach'`, true, []string{"SELECT"}, []string{"SELECT"}},
+		{`SELECT 'a\' , b`, false, []string{"SELECT", "B"}, []string{"SELECT", "B"}},
+		{"SELECT a_1$b FROM (SELECT c)", false, []string{"SELECT", "A_1$B", "FROM"}, []string{"SELECT", "A_1$B", "FROM", "SELECT", "C"}},
+	}
+	for _, caso := range casos {
+		principales, todas := sqlWords(caso.texto, caso.backslash)
+		if !reflect.DeepEqual(principales, caso.principales) || !reflect.DeepEqual(todas, caso.todas) {
+			t.Errorf("%q:\nprincipales %q, esperado %q\ntodas %q, esperado %q", caso.texto, principales, caso.principales, todas, caso.todas)
+		}
+	}
+}
+
+func TestCheckStatements(t *testing.T) {
+	casos := []struct {
+		querytype  string
+		script     string
+		allowMulti bool
+		valido     bool
+	}{
+		{"select", "SELECT 1", false, true},
+		{"select", "DELETE FROM t", false, false},
+		{"exec", "UPDATE t SET a = 1", false, true},
+		{"alter", "CREATE TABLE t(a)", false, true},
+		{"alter", "CREATE TABLE t(a); DROP TABLE u", false, false},
+		{"alter", "CREATE TABLE t(a); DROP TABLE u", true, true},
+		{"alter", "CREATE TABLE t(function INT, begin INT); ATTACH DATABASE '/tmp/x.db' AS a; CREATE TABLE a.pwn(x)", true, false},
+		{"alter", "  ;  ", true, false},
+		{"alter", "VACUUM", false, false},
+		{"alter", "VACUUM INTO '/tmp/copia.db'", false, false},
+	}
+	for _, caso := range casos {
+		err := CheckStatements(Consulta{DbType: "sqlite3", Querytype: caso.querytype, Dbquery: caso.script}, caso.allowMulti)
+		if (err == nil) != caso.valido {
+			t.Errorf("%s %q: error %v", caso.querytype, caso.script, err)
+		}
+	}
+
+	err := CheckStatements(Consulta{DbType: "sqlite3", Querytype: "alter", Dbquery: "vacuum"}, false)
+	if err == nil || !strings.Contains(err.Error(), "ATTACH interno") {
+		t.Errorf("VACUUM: se esperaba un error que explique el ATTACH interno, obtenido %v", err)
+	}
+}
+
+func TestSqliteAttachLimit(t *testing.T) {
+	dir := t.TempDir()
+	db, err := GetPool("sqlite3", WriterDSN(filepath.Join(dir, "a.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("ATTACH DATABASE ? AS b", filepath.Join(dir, "b.db")); err == nil {
+		t.Error("ATTACH debería fallar con SQLITE_LIMIT_ATTACHED en 0")
+	}
+	// VACUUM y VACUUM INTO usan un ATTACH interno, por eso sqlguard los rechaza
+	for _, sentencia := range []string{"VACUUM", "VACUUM INTO '" + filepath.Join(dir, "copia.db") + "'"} {
+		if _, err := db.Exec(sentencia); err == nil {
+			t.Errorf("%s debería fallar con SQLITE_LIMIT_ATTACHED en 0", sentencia)
+		}
+	}
+}
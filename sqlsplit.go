@@ -0,0 +1,275 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Statement es una sentencia individual de un script SQL
+type Statement struct {
+	Text         string
+	Placeholders int // cantidad de marcadores ? fuera de cadenas y comentarios
+}
+
+// bloques que abren un cuerpo compuesto terminado en END
+var compoundObjects = map[string]struct{}{"TRIGGER": {}, "PROCEDURE": {}, "FUNCTION": {}, "EVENT": {}}
+
+// palabras tras las que BEGIN abre un bloque dentro de un cuerpo compuesto; en
+// otra posición begin es un identificador
+var blockStarters = map[string]struct{}{
+	";": {}, ":": {}, "THEN": {}, "ELSE": {}, "DO": {}, "LOOP": {}, "REPEAT": {}, "BEGIN": {},
+}
+
+// SplitStatements separa un script en sentencias por ';' ignorando los que
+// aparecen dentro de cadenas, identificadores entre comillas, comentarios y
+// cuerpos BEGIN ... END de triggers y rutinas. backslash indica si '\' escapa
+// caracteres dentro de las cadenas y si '#' inicia un comentario (MySQL)
+func SplitStatements(script string, backslash bool) []Statement {
+	return splitStatements(script, backslash, true)
+}
+
+// splitStatements con compuestas en false corta en cada ';' fuera de cadenas y
+// comentarios, también dentro de un cuerpo BEGIN ... END
+func splitStatements(script string, backslash, compuestas bool) []Statement {
+	var sentencias []Statement
+	var actual strings.Builder
+	placeholders := 0
+	profundidad := 0 // bloques BEGIN/CASE abiertos dentro de un cuerpo compuesto
+	primera := ""    // primera palabra de la sentencia
+	compuesta := false
+	cuerpo := false // ya empezó el cuerpo BEGIN de la sentencia compuesta
+	parentesis := 0 // paréntesis abiertos, los parámetros de una rutina pueden llamarse begin
+	previo := ""    // último símbolo o palabra en mayúsculas fuera de cadenas y comentarios
+	vacia := true   // sin contenido aparte de espacios y comentarios
+
+	cerrar := func() {
+		if !vacia {
+			sentencias = append(sentencias, Statement{Text: strings.TrimSpace(actual.String()), Placeholders: placeholders})
+		}
+		actual.Reset()
+		placeholders = 0
+		profundidad = 0
+		primera = ""
+		compuesta = false
+		cuerpo = false
+		parentesis = 0
+		previo = ""
+		vacia = true
+	}
+
+	runes := []rune(script)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			j := i + 1
+			for j < n {
+				if backslash && r != '`' && runes[j] == '\\' && j+1 < n {
+					j += 2
+					continue
+				}
+				if runes[j] == r {
+					// comilla duplicada dentro de la cadena
+					if j+1 < n && runes[j+1] == r {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= n {
+				j = n - 1
+			}
+			actual.WriteString(string(runes[i : j+1]))
+			vacia = false
+			previo = string(r)
+			i = j
+		case isLineComment(runes, i, backslash):
+			j := i
+			for j < n && runes[j] != '\n' {
+				j++
+			}
+			actual.WriteString(string(runes[i:j]))
+			i = j - 1
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			j := i + 2
+			for j+1 < n && !(runes[j] == '*' && runes[j+1] == '/') {
+				j++
+			}
+			fin := j + 2
+			if fin > n {
+				fin = n
+			}
+			// los comentarios /*! ... */ de MySQL se ejecutan, cuentan como contenido
+			if i+2 < n && runes[i+2] == '!' {
+				vacia = false
+			}
+			actual.WriteString(string(runes[i:fin]))
+			i = fin - 1
+		case r == ';' && profundidad == 0:
+			cerrar()
+		case r == '?':
+			placeholders++
+			actual.WriteRune(r)
+			vacia = false
+			previo = "?"
+		case unicode.IsLetter(r) || r == '_':
+			palabra, j := readWord(runes, i)
+			if primera == "" {
+				primera = palabra
+				compuesta = compuestas && palabra == "CREATE" && isCompoundCreate(runes, j, backslash)
+			}
+			// la profundidad se cuenta desde el BEGIN del cuerpo; antes CASE y
+			// END son parte de expresiones y begin puede ser un identificador
+			if compuesta {
+				switch {
+				case palabra == "BEGIN" && parentesis == 0 && (!cuerpo || In(blockStarters, previo)):
+					cuerpo = true
+					profundidad++
+				case palabra == "CASE" && cuerpo:
+					profundidad++
+				case palabra == "END" && cuerpo:
+					// END IF, END LOOP, END WHILE, END REPEAT y END CASE son una sola
+					// palabra de cierre; de esos bloques solo CASE se cuenta
+					cierra := true
+					siguiente, fin := readWord(runes, skipSpace(runes, j))
+					switch siguiente {
+					case "IF", "LOOP", "WHILE", "REPEAT":
+						cierra = false
+						j = fin
+					case "CASE":
+						j = fin
+					}
+					if cierra && profundidad > 0 {
+						profundidad--
+					}
+				}
+			}
+			actual.WriteString(string(runes[i:j]))
+			vacia = false
+			previo = palabra
+			i = j - 1
+		default:
+			actual.WriteRune(r)
+			if !unicode.IsSpace(r) {
+				vacia = false
+				previo = string(r)
+			}
+			switch r {
+			case '(':
+				parentesis++
+			case ')':
+				if parentesis > 0 {
+					parentesis--
+				}
+			}
+		}
+	}
+	cerrar()
+	return sentencias
+}
+
+// isLineComment indica si en la posición i empieza un comentario de línea. En MySQL
+// "--" solo es comentario si le sigue un espacio y "#" también inicia comentario
+func isLineComment(runes []rune, i int, backslash bool) bool {
+	if runes[i] == '#' {
+		return backslash
+	}
+	if runes[i] != '-' || i+1 >= len(runes) || runes[i+1] != '-' {
+		return false
+	}
+	if !backslash {
+		return true
+	}
+	return i+2 >= len(runes) || unicode.IsSpace(runes[i+2])
+}
+
+// readWord devuelve en mayúsculas la palabra que empieza en desde y la posición
+// siguiente a ella, o "" si en desde no empieza una palabra
+func readWord(runes []rune, desde int) (string, int) {
+	j := desde
+	for j < len(runes) && (unicode.IsLetter(runes[j]) || (j > desde && (unicode.IsDigit(runes[j]) || runes[j] == '$')) || runes[j] == '_') {
+		j++
+	}
+	return strings.ToUpper(string(runes[desde:j])), j
+}
+
+func skipSpace(runes []rune, i int) int {
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// skipSpaceAndComments salta espacios y comentarios desde i
+func skipSpaceAndComments(runes []rune, i int, backslash bool) int {
+	for {
+		i = skipSpace(runes, i)
+		switch {
+		case i < len(runes) && isLineComment(runes, i, backslash):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case i+1 < len(runes) && runes[i] == '/' && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i += 2
+		default:
+			return i
+		}
+	}
+}
+
+// isCompoundCreate indica si después de CREATE (que termina en desde) sigue
+// [DEFINER = cuenta] [TEMP | TEMPORARY] TRIGGER | PROCEDURE | FUNCTION | EVENT
+func isCompoundCreate(runes []rune, desde int, backslash bool) bool {
+	palabra, i := readWord(runes, skipSpaceAndComments(runes, desde, backslash))
+	if palabra == "DEFINER" {
+		i = skipSpaceAndComments(runes, i, backslash)
+		if i >= len(runes) || runes[i] != '=' {
+			return false
+		}
+		i = skipAccount(runes, skipSpaceAndComments(runes, i+1, backslash))
+		palabra, i = readWord(runes, skipSpaceAndComments(runes, i, backslash))
+	}
+	if palabra == "TEMP" || palabra == "TEMPORARY" {
+		palabra, _ = readWord(runes, skipSpaceAndComments(runes, i, backslash))
+	}
+	return In(compoundObjects, palabra)
+}
+
+// skipAccount salta una cuenta de DEFINER: usuario[@host] con o sin comillas, o CURRENT_USER[()]
+func skipAccount(runes []rune, i int) int {
+	i = skipAccountPart(runes, i)
+	if i < len(runes) && runes[i] == '@' {
+		i = skipAccountPart(runes, i+1)
+	}
+	if i+1 < len(runes) && runes[i] == '(' && runes[i+1] == ')' {
+		i += 2
+	}
+	return i
+}
+
+func skipAccountPart(runes []rune, i int) int {
+	if i < len(runes) && (runes[i] == '\'' || runes[i] == '"' || runes[i] == '`') {
+		comilla := runes[i]
+		for i++; i < len(runes); i++ {
+			if runes[i] == comilla {
+				if i+1 < len(runes) && runes[i+1] == comilla {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+		return i
+	}
+	for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("@();", runes[i]) {
+		i++
+	}
+	return i
+}
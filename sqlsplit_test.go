@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		script    string
+		backslash bool
+		esperado  []string
+	}{
+		{"simple", "SELECT 1; SELECT 2", false, []string{"SELECT 1", "SELECT 2"}},
+		{"punto y coma final y vacías", "SELECT 1;;  ; ", false, []string{"SELECT 1"}},
+		{"punto y coma en cadena", "INSERT INTO t VALUES ('a;b'); SELECT 2", false, []string{"INSERT INTO t VALUES ('a;b')", "SELECT 2"}},
+		{"comilla duplicada", "SELECT 'it''s;'; SELECT 2", false, []string{"SELECT 'it''s;'", "SELECT 2"}},
+		{"backslash en mysql", `SELECT 'a\';b'; SELECT 2`, true, []string{`SELECT 'a\';b'`, "SELECT 2"}},
+		{"backslash en sqlite", `SELECT 'a\'; SELECT 2`, false, []string{`SELECT 'a\'`, "SELECT 2"}},
+		{"identificador entre comillas", "SELECT `a;b` FROM t; SELECT \"c;d\"", true, []string{"SELECT `a;b` FROM t", "SELECT \"c;d\""}},
+		{"comentario de línea", "SELECT 1 -- fin; no\n; SELECT 2", false, []string{"SELECT 1 -- fin; no", "SELECT 2"}},
+		{"numeral en mysql", "SELECT 1 # a;b\n; SELECT 2", true, []string{"SELECT 1 # a;b", "SELECT 2"}},
+		{"comentario de bloque", "SELECT /* ; */ 1; SELECT 2", false, []string{"SELECT /* ; */ 1", "SELECT 2"}},
+		{"solo comentarios", "-- nada\n; /* tampoco */", false, nil},
+		{"trigger sqlite", "CREATE TRIGGER tr AFTER INSERT ON t BEGIN INSERT INTO l VALUES (1); UPDATE c SET n = n + 1; END; SELECT 1", false,
+			[]string{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN INSERT INTO l VALUES (1); UPDATE c SET n = n + 1; END", "SELECT 1"}},
+		{"procedimiento con IF y LOOP", "CREATE PROCEDURE p() BEGIN IF x THEN SELECT 1; END IF; l: LOOP LEAVE l; END LOOP; END; SELECT 2", true,
+			[]string{"CREATE PROCEDURE p() BEGIN IF x THEN SELECT 1; END IF; l: LOOP LEAVE l; END LOOP; END", "SELECT 2"}},
+		{"END CASE", "CREATE PROCEDURE p() BEGIN CASE x WHEN 1 THEN SELECT 1; ELSE SELECT 2; END CASE; END; SELECT 3; SELECT 4", true,
+			[]string{"CREATE PROCEDURE p() BEGIN CASE x WHEN 1 THEN SELECT 1; ELSE SELECT 2; END CASE; END", "SELECT 3", "SELECT 4"}},
+		{"expresión CASE en el cuerpo", "CREATE FUNCTION f(x INT) RETURNS INT BEGIN RETURN CASE WHEN x > 0 THEN 1 ELSE 0 END; END; SELECT 1", true,
+			[]string{"CREATE FUNCTION f(x INT) RETURNS INT BEGIN RETURN CASE WHEN x > 0 THEN 1 ELSE 0 END; END", "SELECT 1"}},
+		{"bloque anidado", "CREATE PROCEDURE p() BEGIN lbl: BEGIN SELECT 1; END; END; SELECT 2", true,
+			[]string{"CREATE PROCEDURE p() BEGIN lbl: BEGIN SELECT 1; END; END", "SELECT 2"}},
+		{"columnas llamadas function y begin", "CREATE TABLE t(function INT, begin INT); ATTACH DATABASE '/tmp/x.db' AS a; CREATE TABLE a.pwn(x)", false,
+			[]string{"CREATE TABLE t(function INT, begin INT)", "ATTACH DATABASE '/tmp/x.db' AS a", "CREATE TABLE a.pwn(x)"}},
+		{"parámetro llamado begin", "CREATE PROCEDURE p(begin INT) BEGIN SELECT begin; END; SELECT 2", true,
+			[]string{"CREATE PROCEDURE p(begin INT) BEGIN SELECT begin; END", "SELECT 2"}},
+		{"vista con columna trigger", "CREATE VIEW v AS SELECT trigger, begin FROM t; SELECT 1", false,
+			[]string{"CREATE VIEW v AS SELECT trigger, begin FROM t", "SELECT 1"}},
+		{"definer", "CREATE DEFINER=`root`@`%` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END; SELECT 1", true,
+			[]string{"CREATE DEFINER=`root`@`%` TRIGGER tr BEFORE INSERT ON t FOR EACH ROW BEGIN SET NEW.a = 1; END", "SELECT 1"}},
+		{"definer current_user", "CREATE DEFINER = CURRENT_USER() PROCEDURE p() BEGIN SELECT 1; END; SELECT 2", true,
+			[]string{"CREATE DEFINER = CURRENT_USER() PROCEDURE p() BEGIN SELECT 1; END", "SELECT 2"}},
+		{"trigger temporal", "CREATE TEMP TRIGGER tr AFTER DELETE ON t BEGIN DELETE FROM l; END; SELECT 1", false,
+			[]string{"CREATE TEMP TRIGGER tr AFTER DELETE ON t BEGIN DELETE FROM l; END", "SELECT 1"}},
+		{"trigger sin BEGIN", "CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.a = CASE WHEN 1 THEN 2 END; SELECT 1", true,
+			[]string{"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW SET NEW.a = CASE WHEN 1 THEN 2 END", "SELECT 1"}},
+	}
+	for _, caso := range casos {
+		var obtenido []string
+		for _, s := range SplitStatements(caso.script, caso.backslash) {
+			obtenido = append(obtenido, s.Text)
+		}
+		if !reflect.DeepEqual(obtenido, caso.esperado) {
+			t.Errorf("%s:\nobtenido %q\nesperado %q", caso.nombre, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestSplitStatementsPlaceholders(t *testing.T) {
+	sentencias := SplitStatements("SELECT ? , '?' -- ?\n; UPDATE t SET a = ? WHERE b = ? /* ? */", false)
+	if len(sentencias) != 2 || sentencias[0].Placeholders != 1 || sentencias[1].Placeholders != 2 {
+		t.Errorf("placeholders: %+v", sentencias)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filas escritas entre cada Flush del stream
+const streamFlushRows = 100
+
+// StreamRows ejecuta el select y escribe cada fila en la respuesta a medida que
+// se lee, sin acumular el resultado en memoria, en el formato indicado (ver
+// rowWriter). En json el objeto lleva "status" al final para poder informar un
+// error ocurrido después de enviar las primeras filas. La escritura bloquea
+// mientras el cliente no lee y la consulta se cancela si se desconecta o se
+// vence el tiempo máximo. Al alcanzar un límite de filas o bytes se deja de
+// leer y el estado final lleva "truncated"
+func StreamRows(c *gin.Context, formato, dbtype, destino, consulta string, opciones SelectOptions, parametros ...any) {
+	ctx := c.Request.Context()
+	filas, cerrar, err := openSelect(ctx, dbtype, destino, consulta, parametros...)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	defer cerrar()
+
+	scanner, err := newRowScanner(filas, dbtype, opciones.Metadata)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", formatContentTypes[formato])
+	c.Status(http.StatusOK)
+	w := c.Writer
+	// los bytes de cada fila se cuentan al escribirla, sin codificarla dos veces
+	contador := &countingWriter{w: w}
+	escritor := newRowWriter(formato, contador)
+
+	var info []ColumnInfo
+	if opciones.Metadata {
+		info = scanner.Columns
+	}
+	err = escritor.Begin(scanner.Names(), info)
+
+	total := 0
+	limitador := rowLimiter{limites: opciones.Limits}
+	for err == nil && scanner.Next() {
+		var fila map[string]any
+		if fila, err = scanner.Row(); err != nil {
+			break
+		}
+		if !limitador.Allow(0) {
+			break
+		}
+		antes := contador.n
+		if err = escritor.Row(fila); err != nil {
+			break
+		}
+		limitador.Add(contador.n - antes)
+		total++
+		if total%streamFlushRows == 0 {
+			w.Flush()
+		}
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+
+	// el cliente se desconectó, no hay a quién informar
+	if errors.Is(ctx.Err(), context.Canceled) && !errors.Is(context.Cause(ctx), errShuttingDown) {
+		c.Error(ctx.Err())
+		return
+	}
+
+	estado := gin.H{"status": "success", "rows": total}
+	ResultSet{Truncated: limitador.Truncated}.addTruncated(estado)
+	if err = contextError(ctx, err); err != nil {
+		c.Error(err)
+		estado = streamError(err)
+	}
+	if err := escritor.End(estado); err == errStreamAborted {
+		abortResponse(c)
+		return
+	}
+	w.Flush()
+}
+
+// abortResponse cierra la conexión sin terminar la respuesta chunked para
+// que el cliente vea la respuesta incompleta
+func abortResponse(c *gin.Context) {
+	c.Writer.Flush()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+// streamError arma el estado de error con el mismo código que RespondError
+func streamError(err error) gin.H {
+	_, code := ClassifyError(err)
+	return gin.H{"status": "error", "code": code, "message": err.Error()}
+}
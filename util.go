@@ -643,17 +643,23 @@ func UpdateJsonDatabase(fileName string, data map[string]interface{}) error {
 }
 
 func UpdateFile(fileName string, data []byte) error {
+	return UpdateFileMode(fileName, data, 0644)
+}
+
+// UpdateFileMode es UpdateFile con permisos propios, también se aplican si el
+// archivo ya existía
+func UpdateFileMode(fileName string, data []byte, perm os.FileMode) error {
 	lockFile, err := os.OpenFile(fileName+".lock", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
 	if err != nil {
 		return err
 	}
 	lockFile.Close()
 	defer os.Remove(fileName + ".lock")
-	err = os.WriteFile(fileName, data, 0644)
+	err = os.WriteFile(fileName, data, perm)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Chmod(fileName, perm)
 }
 
 // ReadGobDatabase lee un archivo en formato Gob y devuelve un mapa de interfaces.